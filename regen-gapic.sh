@@ -78,4 +78,9 @@ for manualdir in $(cat $GOCLOUD_DIR/manuals.txt); do
   find "$GOCLOUD_DIR/$manualdir" -name '*.go' -exec sed -i.backup -e 's/setGoogleClientInfo/SetGoogleClientInfo/g' '{}' '+'
 done
 
+# Make the Spanner database admin client's Close idempotent; see closeConn in
+# spanner/admin/database/apiv1/client.go.
+sed -i.backup -e 's/^\([[:space:]]*\)return c\.conn\.Close()$/\1return closeConn(c.conn)/' \
+  "$GOCLOUD_DIR/spanner/admin/database/apiv1/database_admin_client.go"
+
 find $GOCLOUD_DIR -name '*.backup' -delete
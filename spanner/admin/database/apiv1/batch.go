@@ -0,0 +1,122 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	gax "github.com/googleapis/gax-go/v2"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/status"
+)
+
+// forEachDatabase calls f for each distinct name in databaseNames, with at
+// most parallelism calls running at a time; a parallelism of less than 1
+// means 1. It returns the non-nil errors from f, keyed by name. If ctx is
+// done before f has been called for every name, the remaining names are
+// reported with an error for ctx, with the verb describing what was not done,
+// and skipped reports how many there were.
+func forEachDatabase(ctx context.Context, databaseNames []string, parallelism int, verb string, f func(name string) error) (errs map[string]error, skipped int) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		sem  = make(chan struct{}, parallelism)
+		seen = make(map[string]bool)
+	)
+	errs = make(map[string]error)
+	for _, name := range databaseNames {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		// Check ctx first, as select chooses at random between ready cases.
+		started := false
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+				started = true
+			case <-ctx.Done():
+			}
+		}
+		if !started {
+			mu.Lock()
+			errs[name] = status.Errorf(ctxErrCode(ctx), "database: %s not %s: %v", name, verb, ctx.Err())
+			mu.Unlock()
+			skipped++
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := f(name); err != nil {
+				mu.Lock()
+				errs[name] = err
+				mu.Unlock()
+			}
+		}(name)
+	}
+	wg.Wait()
+	return errs, skipped
+}
+
+// GetDatabases gets the databases databaseNames, making at most parallelism
+// GetDatabase calls at a time; a parallelism of less than 1 means 1. It
+// returns the databases it got and the errors for the others, both keyed by
+// database name. If ctx is done before every call has been made, the
+// remaining names are reported with an error for ctx.
+func (c *DatabaseAdminClient) GetDatabases(ctx context.Context, databaseNames []string, parallelism int, opts ...gax.CallOption) (map[string]*databasepb.Database, map[string]error) {
+	var mu sync.Mutex
+	dbs := make(map[string]*databasepb.Database)
+	errs, _ := forEachDatabase(ctx, databaseNames, parallelism, "fetched", func(name string) error {
+		db, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: name}, opts...)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		dbs[name] = db
+		mu.Unlock()
+		return nil
+	})
+	return dbs, errs
+}
+
+// ApplyDDLToDatabases applies the same DDL statements to each of the
+// databases databaseNames as ApplyDDL does, with at most parallelism schema
+// updates in progress at a time; a parallelism of less than 1 means 1. It
+// returns the errors for the databases whose update failed, keyed by
+// database name.
+//
+// The error result is non-nil if the statements are rejected before any
+// update is started, or if ctx was done before every update had been
+// started; in the latter case the databases that were not updated are
+// reported in the map with an error for ctx. Updates that were started are
+// not cancelled when ctx is done, although they are no longer waited for.
+func (c *DatabaseAdminClient) ApplyDDLToDatabases(ctx context.Context, databaseNames []string, statements []string, parallelism int, opts ...gax.CallOption) (map[string]error, error) {
+	if err := checkDDLBatch(statements); err != nil {
+		return nil, err
+	}
+	errs, skipped := forEachDatabase(ctx, databaseNames, parallelism, "updated", func(name string) error {
+		return c.ApplyDDL(ctx, name, statements, opts...)
+	})
+	if skipped > 0 {
+		return errs, status.Errorf(ctxErrCode(ctx), "database: %d schema updates not started: %v", skipped, ctx.Err())
+	}
+	return errs, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// concurrencyServer serves GetDatabase for names without "missing" in them,
+// recording the largest number of calls in progress at once. If release is
+// set, calls signal on started and wait for release to be closed.
+type concurrencyServer struct {
+	mockDatabaseAdminServer
+
+	mu              sync.Mutex
+	active, maxSeen int
+	started         chan struct{}
+	release         chan struct{}
+}
+
+func (s *concurrencyServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	s.mu.Lock()
+	s.active++
+	if s.active > s.maxSeen {
+		s.maxSeen = s.active
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.active--
+		s.mu.Unlock()
+	}()
+	if s.release != nil {
+		select {
+		case s.started <- struct{}{}:
+		default:
+		}
+		select {
+		case <-s.release:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if strings.Contains(req.Name, "missing") {
+		return nil, status.Errorf(codes.NotFound, "database %s not found", req.Name)
+	}
+	return &databasepb.Database{Name: req.Name, State: databasepb.Database_READY}, nil
+}
+
+func TestGetDatabases(t *testing.T) {
+	srv := &concurrencyServer{}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	names := []string{"db1", "db2", "missing", "db3", "db4", "db1"}
+	dbs, errs := c.GetDatabases(context.Background(), names, 2)
+	if len(dbs) != 4 || len(errs) != 1 {
+		t.Errorf("got %d databases and %d errors, want 4 and 1", len(dbs), len(errs))
+	}
+	for _, name := range []string{"db1", "db2", "db3", "db4"} {
+		if dbs[name].GetName() != name {
+			t.Errorf("dbs[%q] = %v", name, dbs[name])
+		}
+	}
+	if code := status.Code(errs["missing"]); code != codes.NotFound {
+		t.Errorf("errs[missing] = %v, want NotFound", errs["missing"])
+	}
+	if srv.maxSeen > 2 {
+		t.Errorf("saw %d concurrent calls, want at most 2", srv.maxSeen)
+	}
+}
+
+func TestGetDatabasesCanceled(t *testing.T) {
+	srv := &concurrencyServer{started: make(chan struct{}, 1), release: make(chan struct{})}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-srv.started
+		cancel()
+	}()
+	dbs, errs := c.GetDatabases(ctx, []string{"db1", "db2", "db3"}, 1)
+	if len(dbs) != 0 || len(errs) != 3 {
+		t.Fatalf("got %d databases and %d errors, want 0 and 3", len(dbs), len(errs))
+	}
+	for name, err := range errs {
+		if status.Code(err) != codes.Canceled {
+			t.Errorf("errs[%q] = %v, want Canceled", name, err)
+		}
+	}
+}
+
+func TestApplyDDLToDatabases(t *testing.T) {
+	srv := &ddlServer{}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	stmts := []string{"CREATE INDEX SingerByName ON Singers(FirstName)"}
+	names := []string{"db1", "db2", "db3", "db2"}
+	errs, err := c.ApplyDDLToDatabases(context.Background(), names, stmts, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 0 {
+		t.Errorf("got errors %v, want none", errs)
+	}
+	if len(srv.updates) != 3 {
+		t.Errorf("got %d updates, want 3", len(srv.updates))
+	}
+
+	srv.updates = nil
+	if _, err := c.ApplyDDLToDatabases(context.Background(), names, nil, 2); err == nil {
+		t.Error("no statements: got nil error, want error")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	errs, err = c.ApplyDDLToDatabases(ctx, names, stmts, 1)
+	if status.Code(err) != codes.Canceled {
+		t.Errorf("canceled: got %v, want Canceled", err)
+	}
+	if len(errs) != 3 {
+		t.Errorf("canceled: got errors %v, want one per database", errs)
+	}
+}
+
+// blockingDDLServer blocks each UpdateDatabaseDdl call until it is
+// cancelled, after reporting its database on started.
+type blockingDDLServer struct {
+	mockDatabaseAdminServer
+	started chan string
+}
+
+func (s *blockingDDLServer) UpdateDatabaseDdl(ctx context.Context, req *databasepb.UpdateDatabaseDdlRequest) (*longrunningpb.Operation, error) {
+	s.started <- req.Database
+	<-ctx.Done()
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func TestApplyDDLToDatabasesCanceledAfterStart(t *testing.T) {
+	names := []string{"db1", "db2", "db3"}
+	srv := &blockingDDLServer{started: make(chan string, len(names))}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for range names {
+			<-srv.started
+		}
+		cancel()
+	}()
+	stmts := []string{"CREATE INDEX SingerByName ON Singers(FirstName)"}
+	errs, err := c.ApplyDDLToDatabases(ctx, names, stmts, len(names))
+	if err != nil {
+		t.Errorf("every update started: got error %v, want nil", err)
+	}
+	if len(errs) != len(names) {
+		t.Errorf("got errors %v, want one per database", errs)
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// closeConn closes conn for DatabaseAdminClient.Close. Closing a connection
+// that is already closed is not an error, so Close may be called more than
+// once, including concurrently; calls after the first return nil.
+//
+// The generated Close is rewritten to call closeConn by regen-gapic.sh.
+func closeConn(conn *grpc.ClientConn) error {
+	if err := conn.Close(); err != grpc.ErrClientConnClosing {
+		return err
+	}
+	return nil
+}
+
+// IsClosed reports whether Close has been called. Close may be called more
+// than once; calls after the first return nil without touching the
+// connection.
+func (c *DatabaseAdminClient) IsClosed() bool {
+	return c.conn.GetState() == connectivity.Shutdown
+}
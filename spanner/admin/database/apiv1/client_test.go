@@ -0,0 +1,117 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/api/option"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	spannerpb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc"
+)
+
+// startServer starts a server for srv, and for the Operations and Spanner
+// services too if srv implements them. It returns the server's address and a function that
+// stops the server.
+func startServer(t *testing.T, srv databasepb.DatabaseAdminServer) (string, func()) {
+	serv := grpc.NewServer()
+	databasepb.RegisterDatabaseAdminServer(serv, srv)
+	if ops, ok := srv.(longrunningpb.OperationsServer); ok {
+		longrunningpb.RegisterOperationsServer(serv, ops)
+	}
+	if data, ok := srv.(spannerpb.SpannerServer); ok {
+		spannerpb.RegisterSpannerServer(serv, data)
+	}
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serv.Serve(lis)
+	return lis.Addr().String(), serv.Stop
+}
+
+// serverOptions returns the options that connect a client to the server at
+// addr.
+func serverOptions(addr string) []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(addr),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()),
+	}
+}
+
+// newServerClient starts a server for srv and returns a client that owns its
+// own connection to it, so that the client may be closed without affecting
+// other tests. If srv also implements the Operations service, it serves that
+// too. The returned function stops the server.
+func newServerClient(t *testing.T, srv databasepb.DatabaseAdminServer, opts ...option.ClientOption) (*DatabaseAdminClient, func()) {
+	addr, stop := startServer(t, srv)
+	c, err := NewDatabaseAdminClient(context.Background(), append(serverOptions(addr), opts...)...)
+	if err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	return c, stop
+}
+
+// doneOp returns a completed operation whose response is resp.
+func doneOp(t *testing.T, resp proto.Message) *longrunningpb.Operation {
+	any, err := ptypes.MarshalAny(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &longrunningpb.Operation{
+		Name:   "longrunning-test",
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: any},
+	}
+}
+
+func TestCloseIdempotent(t *testing.T) {
+	c, stop := newServerClient(t, &mockDatabaseAdminServer{})
+	defer stop()
+
+	if c.IsClosed() {
+		t.Fatal("IsClosed() = true before Close")
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.Close()
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Close #%d: %v", i, err)
+		}
+	}
+	if !c.IsClosed() {
+		t.Error("IsClosed() = false after Close")
+	}
+	if err := c.Close(); err != nil {
+		t.Errorf("Close after Close: %v", err)
+	}
+}
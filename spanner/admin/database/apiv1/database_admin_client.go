@@ -151,7 +151,7 @@ func (c *DatabaseAdminClient) Connection() *grpc.ClientConn {
 // Close closes the connection to the API service. The user should invoke this when
 // the client is no longer required.
 func (c *DatabaseAdminClient) Close() error {
-	return c.conn.Close()
+	return closeConn(c.conn)
 }
 
 // setGoogleClientInfo sets the name and version of the application in
@@ -0,0 +1,248 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// This file holds a deliberately shallow reading of DDL statements, enough to
+// recognise the objects that statements from GetDatabaseDdl create. It only
+// looks at the leading tokens of each statement, so it copes with clauses it
+// does not understand.
+
+// ddlToken is a token of a DDL statement.
+type ddlToken struct {
+	text   string
+	quoted bool // text was a backtick-quoted identifier; text is unquoted
+}
+
+// is reports whether t is the unquoted keyword kw, ignoring case.
+func (t ddlToken) is(kw string) bool {
+	return !t.quoted && strings.EqualFold(t.text, kw)
+}
+
+// ddlTokens splits stmt into identifiers, keywords and single punctuation
+// characters. Backtick-quoted identifiers are unquoted, and quoted strings
+// become a single token.
+func ddlTokens(stmt string) []ddlToken {
+	var toks []ddlToken
+	for i := 0; i < len(stmt); {
+		ch := stmt[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '`' || ch == '\'' || ch == '"':
+			n, err := quotedLen(stmt[i:])
+			if err != nil {
+				n = len(stmt) - i
+			}
+			if ch == '`' && n >= 2 {
+				toks = append(toks, ddlToken{text: stmt[i+1 : i+n-1], quoted: true})
+			} else {
+				toks = append(toks, ddlToken{text: stmt[i : i+n]})
+			}
+			i += n
+		case isIdentChar(ch):
+			j := i
+			for j < len(stmt) && isIdentChar(stmt[j]) {
+				j++
+			}
+			toks = append(toks, ddlToken{text: stmt[i:j]})
+			i = j
+		default:
+			toks = append(toks, ddlToken{text: stmt[i : i+1]})
+			i++
+		}
+	}
+	return toks
+}
+
+// normalizeDDL returns the form of stmt that SchemaDriftReport and
+// DDLEquivalent compare, so that statements differing only in layout
+// compare equal: its tokens separated by single spaces, without trailing
+// semicolons, without a comma directly before a closing parenthesis, such as
+// the one GetDatabaseDdl writes after the last column of a table, and
+// without backticks around identifiers. If foldCase is set, keywords and
+// identifiers, which are case-insensitive in Cloud Spanner, are upper-cased;
+// string literals are kept as they are.
+func normalizeDDL(stmt string, foldCase bool) string {
+	toks := ddlTokens(stmt)
+	for len(toks) > 0 && toks[len(toks)-1].is(";") {
+		toks = toks[:len(toks)-1]
+	}
+	var parts []string
+	for i, t := range toks {
+		switch {
+		case t.is(",") && i+1 < len(toks) && toks[i+1].is(")"):
+		case !foldCase || !t.quoted && (t.text[0] == '\'' || t.text[0] == '"'):
+			parts = append(parts, t.text)
+		default:
+			parts = append(parts, strings.ToUpper(t.text))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// DDLEquivalent reports whether the statements a and b describe the same
+// schema, regardless of the order of the statements and of their layout.
+// Statements are normalised as by SchemaDriftReport, and the case of keywords
+// and identifiers, which are case-insensitive in Cloud Spanner, is ignored.
+// String literals are compared exactly.
+//
+// DDLEquivalent is not a semantic comparison: statements that say the same
+// thing in different ways, such as a column type written with and without
+// its default length or a foreign key declared inline rather than with ALTER
+// TABLE, are not equivalent, and the order of statements is ignored even
+// where it matters, such as an ALTER TABLE that drops a column another
+// statement adds.
+func DDLEquivalent(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	unmatched := make(map[string]int)
+	for _, stmt := range a {
+		unmatched[normalizeDDL(stmt, true)]++
+	}
+	for _, stmt := range b {
+		n := normalizeDDL(stmt, true)
+		if unmatched[n] == 0 {
+			return false
+		}
+		unmatched[n]--
+	}
+	return true
+}
+
+// maxIdentifierLen is the maximum length of a Cloud Spanner identifier.
+const maxIdentifierLen = 128
+
+// validateIdentifier returns an error if ident is not a valid name for a
+// table, column or index: a letter followed by letters, digits and
+// underscores, at most 128 characters long.
+func validateIdentifier(ident string) error {
+	if ident == "" {
+		return errors.New("database: empty identifier")
+	}
+	if len(ident) > maxIdentifierLen {
+		return fmt.Errorf("database: identifier %.20s... is longer than %d characters", ident, maxIdentifierLen)
+	}
+	for i := 0; i < len(ident); i++ {
+		if ch := ident[i]; !isIdentChar(ch) || i == 0 && (ch == '_' || '0' <= ch && ch <= '9') {
+			return fmt.Errorf("database: invalid identifier %q", ident)
+		}
+	}
+	return nil
+}
+
+// QuoteIdentifier returns ident quoted with backticks, for use as a table,
+// column or index name in a DDL statement. Quoting lets ident be a reserved
+// word. It returns an error if ident is not a valid identifier, so that a
+// crafted name cannot change the meaning of a statement. This version of the
+// API supports only the GoogleSQL dialect, so there is no other quoting.
+func QuoteIdentifier(ident string) (string, error) {
+	if err := validateIdentifier(ident); err != nil {
+		return "", err
+	}
+	return quoteIdent(ident), nil
+}
+
+// quoteIdent quotes ident with backticks, without checking it.
+func quoteIdent(ident string) string {
+	return "`" + ident + "`"
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9'
+}
+
+// createDatabaseID returns the database ID named by the CREATE DATABASE
+// statement stmt. It reports false if stmt is not such a statement.
+func createDatabaseID(stmt string) (string, bool) {
+	toks := ddlTokens(stmt)
+	if len(toks) < 3 || !toks[0].is("CREATE") || !toks[1].is("DATABASE") {
+		return "", false
+	}
+	return toks[2].text, true
+}
+
+// ddlObject describes the schema object created or altered by a statement.
+type ddlObject struct {
+	kind       string // "TABLE", "INDEX" or "CONSTRAINT"
+	name       string
+	table      string // the table an index is on or a constraint is added to
+	references string // the table a constraint refers to, if any
+}
+
+// createdObject returns the table or index created by stmt, or the foreign
+// key added by an ALTER TABLE ... ADD CONSTRAINT statement. It reports false
+// for any other statement.
+func createdObject(stmt string) (ddlObject, bool) {
+	toks := ddlTokens(stmt)
+	at := func(i int) ddlToken {
+		if i < len(toks) {
+			return toks[i]
+		}
+		return ddlToken{}
+	}
+	switch {
+	case at(0).is("CREATE") && at(1).is("TABLE") && at(2).text != "":
+		return ddlObject{kind: "TABLE", name: at(2).text}, true
+	case at(0).is("CREATE"):
+		i := 1
+		for at(i).is("UNIQUE") || at(i).is("NULL_FILTERED") {
+			i++
+		}
+		if at(i).is("INDEX") && at(i+2).is("ON") && at(i+1).text != "" && at(i+3).text != "" {
+			return ddlObject{kind: "INDEX", name: at(i + 1).text, table: at(i + 3).text}, true
+		}
+	case at(0).is("ALTER") && at(1).is("TABLE") && at(3).is("ADD") && at(4).is("CONSTRAINT") && at(5).text != "":
+		o := ddlObject{kind: "CONSTRAINT", name: at(5).text, table: at(2).text}
+		for i := 6; i < len(toks); i++ {
+			if toks[i].is("REFERENCES") {
+				o.references = at(i + 1).text
+				break
+			}
+		}
+		return o, true
+	}
+	return ddlObject{}, false
+}
+
+// dropStatement returns the statement that drops o.
+func (o ddlObject) dropStatement() string {
+	if o.kind == "CONSTRAINT" {
+		return "ALTER TABLE " + quoteIdent(o.table) + " DROP CONSTRAINT " + quoteIdent(o.name)
+	}
+	return "DROP " + o.kind + " " + quoteIdent(o.name)
+}
+
+// dropOrder returns statements that drop objs, which are in the order they
+// were created: constraints added after table creation first, then indexes,
+// then tables in the reverse of their creation order, so that interleaved
+// child tables and referencing tables go before the tables they depend on.
+func dropOrder(objs []ddlObject) []string {
+	var stmts []string
+	for _, kind := range []string{"CONSTRAINT", "INDEX", "TABLE"} {
+		for i := len(objs) - 1; i >= 0; i-- {
+			if objs[i].kind == kind {
+				stmts = append(stmts, objs[i].dropStatement())
+			}
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,366 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schema is the structure of a database's tables and indexes, as read by
+// ParseDDLSchema.
+type Schema struct {
+	Tables  []Table
+	Indexes []IndexSpec
+}
+
+// Table describes a table.
+type Table struct {
+	Name       string
+	Columns    []Column
+	PrimaryKey []KeyPart
+
+	// InterleaveIn is the parent table of an interleaved table, or empty.
+	InterleaveIn string
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name string
+	// Type is the column's type as written in the schema, without spaces,
+	// for example "INT64", "STRING(MAX)" or "ARRAY<STRING(1024)>".
+	Type    string
+	NotNull bool
+}
+
+// KeyPart is a column of a primary or index key.
+type KeyPart struct {
+	Column string
+	Desc   bool
+}
+
+// IndexSpec describes an index.
+type IndexSpec struct {
+	Name         string
+	Table        string
+	Columns      []KeyPart
+	Storing      []string
+	Unique       bool
+	NullFiltered bool
+
+	// InterleaveIn is the table an index is interleaved in, or empty.
+	InterleaveIn string
+}
+
+// createStatement returns the CREATE INDEX statement for ix, or an error if
+// any of its names is not a valid identifier.
+func (ix IndexSpec) createStatement() (string, error) {
+	names := []string{ix.Name, ix.Table}
+	for _, kp := range ix.Columns {
+		names = append(names, kp.Column)
+	}
+	names = append(names, ix.Storing...)
+	if ix.InterleaveIn != "" {
+		names = append(names, ix.InterleaveIn)
+	}
+	for _, n := range names {
+		if _, err := QuoteIdentifier(n); err != nil {
+			return "", err
+		}
+	}
+	if len(ix.Columns) == 0 {
+		return "", fmt.Errorf("database: index %s has no key columns", ix.Name)
+	}
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if ix.Unique {
+		b.WriteString("UNIQUE ")
+	}
+	if ix.NullFiltered {
+		b.WriteString("NULL_FILTERED ")
+	}
+	fmt.Fprintf(&b, "INDEX %s ON %s (", quoteIdent(ix.Name), quoteIdent(ix.Table))
+	for i, kp := range ix.Columns {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(quoteIdent(kp.Column))
+		if kp.Desc {
+			b.WriteString(" DESC")
+		}
+	}
+	b.WriteString(")")
+	if len(ix.Storing) > 0 {
+		b.WriteString(" STORING (")
+		for i, col := range ix.Storing {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(quoteIdent(col))
+		}
+		b.WriteString(")")
+	}
+	if ix.InterleaveIn != "" {
+		b.WriteString(", INTERLEAVE IN " + quoteIdent(ix.InterleaveIn))
+	}
+	return b.String(), nil
+}
+
+// ParseDDLSchema reads the tables and indexes created by statements, such as
+// the statements returned by GetDatabaseDdl. It understands the CREATE TABLE
+// and CREATE INDEX statements that the service returns; column options,
+// generated column expressions, constraints and ON DELETE clauses are
+// skipped. Other statements are ignored. It is not a validating parser: it
+// returns an error only for a CREATE TABLE or CREATE INDEX statement it
+// cannot read.
+func ParseDDLSchema(statements []string) (*Schema, error) {
+	s := &Schema{}
+	for i, stmt := range statements {
+		p := &ddlParser{toks: ddlTokens(stmt)}
+		var err error
+		switch o, _ := createdObject(stmt); o.kind {
+		case "TABLE":
+			var t Table
+			if t, err = p.table(); err == nil {
+				s.Tables = append(s.Tables, t)
+			}
+		case "INDEX":
+			var ix IndexSpec
+			if ix, err = p.index(); err == nil {
+				s.Indexes = append(s.Indexes, ix)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("database: statement %d: %v", i, err)
+		}
+	}
+	return s, nil
+}
+
+// ddlParser reads a statement from its tokens.
+type ddlParser struct {
+	toks []ddlToken
+	i    int
+}
+
+func (p *ddlParser) peek() ddlToken {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return ddlToken{}
+}
+
+// accept consumes the next token if it is the keyword or punctuation kw.
+func (p *ddlParser) accept(kw string) bool {
+	if p.peek().is(kw) {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *ddlParser) expect(kws ...string) error {
+	for _, kw := range kws {
+		if !p.accept(kw) {
+			return p.errorf("expected %s", kw)
+		}
+	}
+	return nil
+}
+
+func (p *ddlParser) errorf(format string, args ...interface{}) error {
+	found := "end of statement"
+	if p.i < len(p.toks) {
+		found = fmt.Sprintf("%q", p.toks[p.i].text)
+	}
+	return fmt.Errorf(format+", found %s", append(args, found)...)
+}
+
+// ident consumes an identifier.
+func (p *ddlParser) ident() (string, error) {
+	t := p.peek()
+	if t.quoted || t.text != "" && isIdentChar(t.text[0]) {
+		p.i++
+		return t.text, nil
+	}
+	return "", p.errorf("expected identifier")
+}
+
+// skipElement consumes tokens up to the end of the current element of a
+// parenthesised list, skipping nested parentheses.
+func (p *ddlParser) skipElement() {
+	for depth := 0; p.i < len(p.toks); p.i++ {
+		switch t := p.peek(); {
+		case t.is("("):
+			depth++
+		case t.is(")") && depth == 0, t.is(",") && depth == 0:
+			return
+		case t.is(")"):
+			depth--
+		}
+	}
+}
+
+// table reads a CREATE TABLE statement.
+func (p *ddlParser) table() (Table, error) {
+	var t Table
+	var err error
+	if err = p.expect("CREATE", "TABLE"); err != nil {
+		return t, err
+	}
+	if t.Name, err = p.ident(); err != nil {
+		return t, err
+	}
+	if err = p.expect("("); err != nil {
+		return t, err
+	}
+	for !p.accept(")") {
+		if p.peek().is("CONSTRAINT") || p.peek().is("FOREIGN") || p.peek().is("CHECK") {
+			p.skipElement()
+		} else {
+			c, err := p.column()
+			if err != nil {
+				return t, err
+			}
+			t.Columns = append(t.Columns, c)
+		}
+		if !p.accept(",") && !p.peek().is(")") {
+			return t, p.errorf("expected , or )")
+		}
+	}
+	if err = p.expect("PRIMARY", "KEY"); err != nil {
+		return t, err
+	}
+	if t.PrimaryKey, err = p.keyParts(); err != nil {
+		return t, err
+	}
+	if p.accept(",") {
+		if err = p.expect("INTERLEAVE", "IN", "PARENT"); err != nil {
+			return t, err
+		}
+		if t.InterleaveIn, err = p.ident(); err != nil {
+			return t, err
+		}
+	}
+	return t, nil
+}
+
+// column reads a column definition.
+func (p *ddlParser) column() (Column, error) {
+	var c Column
+	var err error
+	if c.Name, err = p.ident(); err != nil {
+		return c, err
+	}
+	var typ []string
+	for depth := 0; p.i < len(p.toks); p.i++ {
+		t := p.peek()
+		if depth == 0 && (t.is(",") || t.is(")") || t.is("NOT") || t.is("OPTIONS") || t.is("AS")) {
+			break
+		}
+		switch {
+		case t.is("(") || t.is("<"):
+			depth++
+		case t.is(")") || t.is(">"):
+			depth--
+		}
+		typ = append(typ, t.text)
+	}
+	if len(typ) == 0 {
+		return c, p.errorf("expected type of column %s", c.Name)
+	}
+	c.Type = strings.Join(typ, "")
+	if p.accept("NOT") {
+		c.NotNull = p.accept("NULL")
+	}
+	// Skip options and generated column expressions.
+	p.skipElement()
+	return c, nil
+}
+
+// keyParts reads a parenthesised list of key columns.
+func (p *ddlParser) keyParts() ([]KeyPart, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var parts []KeyPart
+	for !p.accept(")") {
+		col, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		kp := KeyPart{Column: col}
+		if p.accept("DESC") {
+			kp.Desc = true
+		} else {
+			p.accept("ASC")
+		}
+		parts = append(parts, kp)
+		if !p.accept(",") && !p.peek().is(")") {
+			return nil, p.errorf("expected , or )")
+		}
+	}
+	return parts, nil
+}
+
+// index reads a CREATE INDEX statement.
+func (p *ddlParser) index() (IndexSpec, error) {
+	var ix IndexSpec
+	var err error
+	if err = p.expect("CREATE"); err != nil {
+		return ix, err
+	}
+	ix.Unique = p.accept("UNIQUE")
+	ix.NullFiltered = p.accept("NULL_FILTERED")
+	if err = p.expect("INDEX"); err != nil {
+		return ix, err
+	}
+	if ix.Name, err = p.ident(); err != nil {
+		return ix, err
+	}
+	if err = p.expect("ON"); err != nil {
+		return ix, err
+	}
+	if ix.Table, err = p.ident(); err != nil {
+		return ix, err
+	}
+	if ix.Columns, err = p.keyParts(); err != nil {
+		return ix, err
+	}
+	if p.accept("STORING") {
+		if err = p.expect("("); err != nil {
+			return ix, err
+		}
+		for !p.accept(")") {
+			col, err := p.ident()
+			if err != nil {
+				return ix, err
+			}
+			ix.Storing = append(ix.Storing, col)
+			if !p.accept(",") && !p.peek().is(")") {
+				return ix, p.errorf("expected , or )")
+			}
+		}
+	}
+	if p.accept(",") {
+		if err = p.expect("INTERLEAVE", "IN"); err != nil {
+			return ix, err
+		}
+		if ix.InterleaveIn, err = p.ident(); err != nil {
+			return ix, err
+		}
+	}
+	return ix, nil
+}
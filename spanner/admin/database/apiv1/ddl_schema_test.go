@@ -0,0 +1,98 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDDLSchema(t *testing.T) {
+	stmts := append([]string{
+		"CREATE TABLE Events (\n  Id STRING(36) NOT NULL,\n  Tags ARRAY<STRING(MAX)>,\n  Total INT64 AS (Id + 1) STORED,\n) PRIMARY KEY(Id DESC)",
+	}, singerStatements...)
+	got, err := ParseDDLSchema(stmts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Schema{
+		Tables: []Table{{
+			Name: "Events",
+			Columns: []Column{
+				{Name: "Id", Type: "STRING(36)", NotNull: true},
+				{Name: "Tags", Type: "ARRAY<STRING(MAX)>"},
+				{Name: "Total", Type: "INT64"},
+			},
+			PrimaryKey: []KeyPart{{Column: "Id", Desc: true}},
+		}, {
+			Name: "Singers",
+			Columns: []Column{
+				{Name: "SingerId", Type: "INT64", NotNull: true},
+				{Name: "FirstName", Type: "STRING(1024)"},
+			},
+			PrimaryKey: []KeyPart{{Column: "SingerId"}},
+		}, {
+			Name: "Order",
+			Columns: []Column{
+				{Name: "OrderId", Type: "INT64", NotNull: true},
+				{Name: "SingerId", Type: "INT64"},
+				{Name: "UpdatedAt", Type: "TIMESTAMP"},
+			},
+			PrimaryKey: []KeyPart{{Column: "OrderId"}},
+		}, {
+			Name: "Albums",
+			Columns: []Column{
+				{Name: "SingerId", Type: "INT64", NotNull: true},
+				{Name: "AlbumId", Type: "INT64", NotNull: true},
+			},
+			PrimaryKey:   []KeyPart{{Column: "SingerId"}, {Column: "AlbumId"}},
+			InterleaveIn: "Singers",
+		}},
+		Indexes: []IndexSpec{{
+			Name:    "SingerByName",
+			Table:   "Singers",
+			Columns: []KeyPart{{Column: "FirstName"}},
+		}, {
+			Name:         "AlbumsByAlbumId",
+			Table:        "Albums",
+			Columns:      []KeyPart{{Column: "AlbumId"}},
+			Storing:      []string{"SingerId"},
+			Unique:       true,
+			NullFiltered: true,
+			InterleaveIn: "Singers",
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseDDLSchemaErrors(t *testing.T) {
+	for _, test := range []struct {
+		stmt, wantErr string
+	}{
+		{"CREATE TABLE T (A INT64) PRIMARY (A)", `statement 0: expected KEY, found "("`},
+		{"CREATE TABLE T (A) PRIMARY KEY (A)", `expected type of column A, found ")"`},
+		{"CREATE TABLE T (A INT64 NOT NULL", "expected , or ), found end of statement"},
+		{"CREATE INDEX I ON T", "expected (, found end of statement"},
+		{"CREATE INDEX I ON T (A) STORING B", `expected (, found "B"`},
+	} {
+		_, err := ParseDDLSchema([]string{test.stmt})
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("%q: got error %v, want one containing %q", test.stmt, err, test.wantErr)
+		}
+	}
+}
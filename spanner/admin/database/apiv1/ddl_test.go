@@ -0,0 +1,52 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import "testing"
+
+func TestDDLEquivalent(t *testing.T) {
+	for _, test := range []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, nil, true},
+		{singerStatements, singerStatements, true},
+		{
+			[]string{"CREATE TABLE Singers (\n  SingerId INT64 NOT NULL,\n) PRIMARY KEY(SingerId)", "CREATE INDEX SingerByName ON Singers(FirstName)"},
+			[]string{"create index singerbyname on `Singers` (FirstName);", "CREATE TABLE `Singers` (SingerId INT64 NOT NULL) PRIMARY KEY (SingerId)"},
+			true,
+		},
+		{
+			[]string{"CREATE TABLE T (A STRING(MAX) OPTIONS (x='a')) PRIMARY KEY (A)"},
+			[]string{"CREATE TABLE T (A STRING(MAX) OPTIONS (x='A')) PRIMARY KEY (A)"},
+			false,
+		},
+		{
+			[]string{"CREATE TABLE T (A INT64) PRIMARY KEY (A)"},
+			[]string{"CREATE TABLE T (A INT64 NOT NULL) PRIMARY KEY (A)"},
+			false,
+		},
+		{
+			[]string{"CREATE INDEX I ON T (A)", "CREATE INDEX I ON T (A)"},
+			[]string{"CREATE INDEX I ON T (A)", "CREATE INDEX J ON T (A)"},
+			false,
+		},
+		{[]string{"CREATE INDEX I ON T (A)"}, nil, false},
+	} {
+		if got := DDLEquivalent(test.a, test.b); got != test.want {
+			t.Errorf("DDLEquivalent(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
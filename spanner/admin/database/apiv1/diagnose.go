@@ -0,0 +1,131 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	gax "github.com/googleapis/gax-go/v2"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// diagnosedPermissions are the permissions Diagnose checks the caller has on
+// a database.
+var diagnosedPermissions = []string{
+	"spanner.databases.get",
+	"spanner.databases.getDdl",
+	"spanner.databases.updateDdl",
+	"spanner.databases.drop",
+	"spanner.databases.getIamPolicy",
+	"spanner.databases.setIamPolicy",
+	"spanner.databases.read",
+	"spanner.databases.write",
+}
+
+// DiagnosisReport is the outcome of Diagnose.
+type DiagnosisReport struct {
+	Database string
+
+	// Connected reports whether any call reached the service.
+	Connected bool
+
+	// Authenticated reports whether the service accepted the caller's
+	// credentials.
+	Authenticated bool
+
+	// MissingPermissions lists the checked permissions that the caller does
+	// not have on the database. It is empty if the check could not be made.
+	MissingPermissions []string
+
+	// Checks holds the outcome of each check, in the order they were made.
+	Checks []DiagnosisCheck
+}
+
+// DiagnosisCheck is the outcome of a single check made by Diagnose.
+type DiagnosisCheck struct {
+	// Name is the name of the check: "GetDatabase" or "TestIamPermissions".
+	Name   string
+	Passed bool
+	// Err is the error that made the check fail, if any.
+	Err error
+}
+
+// OK reports whether every check passed.
+func (r *DiagnosisReport) OK() bool {
+	for _, c := range r.Checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Diagnose checks whether the caller can reach and administer the database
+// databaseName, for troubleshooting a setup. It reads the database and tests
+// the caller's permissions on it for getting, changing the schema of,
+// dropping, reading and writing the database and managing its IAM policy.
+// Failed checks are recorded in the returned report rather than returned as
+// an error; Diagnose returns an error only if databaseName is malformed.
+func (c *DatabaseAdminClient) Diagnose(ctx context.Context, databaseName string, opts ...gax.CallOption) (*DiagnosisReport, error) {
+	if _, _, err := parseDatabaseName(databaseName); err != nil {
+		return nil, err
+	}
+	r := &DiagnosisReport{Database: databaseName}
+	record := func(name string, err error) {
+		r.Checks = append(r.Checks, DiagnosisCheck{Name: name, Passed: err == nil, Err: err})
+		code := status.Code(err)
+		if err == context.DeadlineExceeded || err == context.Canceled {
+			// Retried calls report the context's error as it is.
+			code = codes.DeadlineExceeded
+		}
+		switch code {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		case codes.Unauthenticated:
+			r.Connected = true
+		default:
+			r.Connected = true
+			r.Authenticated = true
+		}
+	}
+
+	_, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: databaseName}, opts...)
+	record("GetDatabase", err)
+
+	resp, err := c.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{
+		Resource:    databaseName,
+		Permissions: diagnosedPermissions,
+	}, opts...)
+	if err == nil {
+		granted := make(map[string]bool)
+		for _, p := range resp.Permissions {
+			granted[p] = true
+		}
+		for _, p := range diagnosedPermissions {
+			if !granted[p] {
+				r.MissingPermissions = append(r.MissingPermissions, p)
+			}
+		}
+		if len(r.MissingPermissions) > 0 {
+			err = fmt.Errorf("database: missing permissions on %s: %s", databaseName, strings.Join(r.MissingPermissions, ", "))
+		}
+	}
+	record("TestIamPermissions", err)
+	return r, nil
+}
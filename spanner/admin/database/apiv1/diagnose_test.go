@@ -0,0 +1,111 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// diagnoseServer fails GetDatabase with err, and TestIamPermissions with
+// iamErr, granting the permissions in granted otherwise.
+type diagnoseServer struct {
+	getDatabaseErrServer
+	iamErr  error
+	granted []string
+}
+
+func (s *diagnoseServer) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	if s.iamErr != nil {
+		return nil, s.iamErr
+	}
+	var perms []string
+	for _, p := range req.Permissions {
+		for _, g := range s.granted {
+			if p == g {
+				perms = append(perms, p)
+			}
+		}
+	}
+	return &iampb.TestIamPermissionsResponse{Permissions: perms}, nil
+}
+
+func TestDiagnose(t *testing.T) {
+	const db = "projects/p/instances/i/databases/d"
+	srv := &diagnoseServer{}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+	ctx := context.Background()
+
+	srv.granted = diagnosedPermissions
+	r, err := c.Diagnose(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() || !r.Connected || !r.Authenticated || len(r.MissingPermissions) != 0 || len(r.Checks) != 2 {
+		t.Errorf("all checks passing: got %+v", r)
+	}
+
+	srv.err = status.Error(codes.PermissionDenied, "denied")
+	srv.granted = []string{"spanner.databases.read", "spanner.databases.write"}
+	if r, err = c.Diagnose(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || !r.Connected || !r.Authenticated {
+		t.Errorf("permission denied: got %+v", r)
+	}
+	if want := diagnosedPermissions[:6]; !reflect.DeepEqual(r.MissingPermissions, want) {
+		t.Errorf("got missing permissions %q, want %q", r.MissingPermissions, want)
+	}
+	for _, check := range r.Checks {
+		if check.Passed || check.Err == nil {
+			t.Errorf("check %s passed, want it to fail", check.Name)
+		}
+	}
+	if got := status.Code(r.Checks[0].Err); r.Checks[0].Name != "GetDatabase" || got != codes.PermissionDenied {
+		t.Errorf("got first check %s failing with %v, want GetDatabase failing with PermissionDenied", r.Checks[0].Name, got)
+	}
+
+	srv.err = status.Error(codes.Unauthenticated, "no credentials")
+	srv.iamErr = srv.err
+	if r, err = c.Diagnose(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || !r.Connected || r.Authenticated || len(r.MissingPermissions) != 0 {
+		t.Errorf("unauthenticated: got %+v", r)
+	}
+
+	// Calls to a stopped server are retried until the deadline.
+	stop()
+	tctx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if r, err = c.Diagnose(tctx, db); err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || r.Connected || r.Authenticated {
+		t.Errorf("server stopped: got %+v", r)
+	}
+
+	if _, err := c.Diagnose(ctx, "d"); err == nil {
+		t.Error("got nil error for a malformed database name")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	gax "github.com/googleapis/gax-go/v2"
+	edpb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NotFoundError is the error Probe returns when the instance or the database
+// does not exist. It carries the service's NotFound status, which
+// status.Code and status.FromError report.
+type NotFoundError struct {
+	// Resource is "instance" or "database".
+	Resource string
+
+	status *status.Status
+}
+
+// Errors returned by Probe. Probe's errors carry the service's status, so
+// they are not equal to these; match them with errors.Is, or with a type
+// assertion to *NotFoundError and its Resource field before Go 1.13.
+var (
+	ErrInstanceNotFound = &NotFoundError{Resource: "instance"}
+	ErrDatabaseNotFound = &NotFoundError{Resource: "database"}
+)
+
+func (e *NotFoundError) Error() string {
+	if e.status == nil {
+		return "database: " + e.Resource + " not found"
+	}
+	return "database: " + e.Resource + " not found: " + e.status.Message()
+}
+
+// GRPCStatus returns the service's status, or a NotFound status for
+// ErrInstanceNotFound and ErrDatabaseNotFound themselves.
+func (e *NotFoundError) GRPCStatus() *status.Status {
+	if e.status == nil {
+		return status.New(codes.NotFound, e.Error())
+	}
+	return e.status
+}
+
+// Is reports whether target is a *NotFoundError for the same kind of
+// resource, such as ErrInstanceNotFound or ErrDatabaseNotFound.
+func (e *NotFoundError) Is(target error) bool {
+	t, ok := target.(*NotFoundError)
+	return ok && t.Resource == e.Resource
+}
+
+// Probe checks that databaseName is a well-formed database name and that the
+// database can be read, as a pre-flight check before a schema change or other
+// administrative operation. It returns nil if the database exists, a
+// *NotFoundError matching ErrInstanceNotFound or ErrDatabaseNotFound if the
+// instance or the database does not exist, and any other error, such as a
+// PermissionDenied error, unchanged.
+func (c *DatabaseAdminClient) Probe(ctx context.Context, databaseName string, opts ...gax.CallOption) error {
+	if _, _, err := parseDatabaseName(databaseName); err != nil {
+		return err
+	}
+	_, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: databaseName}, opts...)
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	s, _ := status.FromError(err)
+	if instanceNotFound(err) {
+		return &NotFoundError{Resource: "instance", status: s}
+	}
+	return &NotFoundError{Resource: "database", status: s}
+}
+
+// instanceNotFound reports whether the NotFound error err is about an
+// instance rather than a database, going by its ResourceInfo details if it
+// has any and by its message otherwise.
+func instanceNotFound(err error) bool {
+	s, _ := status.FromError(err)
+	for _, d := range s.Details() {
+		if ri, ok := d.(*edpb.ResourceInfo); ok {
+			return strings.HasSuffix(ri.ResourceType, "Instance")
+		}
+	}
+	return strings.HasPrefix(strings.ToLower(s.Message()), "instance not found")
+}
+
+// RetryDelayFromError returns the retry delay suggested by the server in the
+// RetryInfo details of err, if there is one.
+func RetryDelayFromError(err error) (time.Duration, bool) {
+	s, ok := status.FromError(err)
+	if !ok {
+		return 0, false
+	}
+	for _, d := range s.Details() {
+		ri, ok := d.(*edpb.RetryInfo)
+		if !ok {
+			continue
+		}
+		delay, err := ptypes.Duration(ri.RetryDelay)
+		if err != nil {
+			return 0, false
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// ExitCodeForError returns a process exit code for err, for command-line
+// tools built on this package. The mapping is stable:
+//
+//	nil                                0
+//	InvalidArgument                    2
+//	NotFound                           4
+//	PermissionDenied, Unauthenticated  77
+//	any other error                    1
+//
+// Errors that do not carry a gRPC status map to 1.
+func ExitCodeForError(err error) int {
+	if err == nil {
+		return 0
+	}
+	switch status.Code(err) {
+	case codes.InvalidArgument:
+		return 2
+	case codes.NotFound:
+		return 4
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return 77
+	default:
+		return 1
+	}
+}
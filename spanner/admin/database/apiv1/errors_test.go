@@ -0,0 +1,183 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	edpb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func errWithRetryDelay(t *testing.T, delay time.Duration) error {
+	s, err := status.New(codes.ResourceExhausted, "quota exceeded").WithDetails(&edpb.RetryInfo{
+		RetryDelay: ptypes.DurationProto(delay),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.Err()
+}
+
+func TestRetryDelayFromError(t *testing.T) {
+	for _, test := range []struct {
+		err       error
+		wantDelay time.Duration
+		wantOK    bool
+	}{
+		{nil, 0, false},
+		{errors.New("not a status"), 0, false},
+		{status.Error(codes.Unavailable, "no details"), 0, false},
+		{errWithRetryDelay(t, 1500*time.Millisecond), 1500 * time.Millisecond, true},
+	} {
+		delay, ok := RetryDelayFromError(test.err)
+		if delay != test.wantDelay || ok != test.wantOK {
+			t.Errorf("RetryDelayFromError(%v) = (%v, %t), want (%v, %t)", test.err, delay, ok, test.wantDelay, test.wantOK)
+		}
+	}
+}
+
+// throttledServer fails the first GetDatabase call with a server-suggested
+// retry delay.
+type throttledServer struct {
+	mockDatabaseAdminServer
+	err   error
+	calls int
+}
+
+func (s *throttledServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	s.calls++
+	if s.calls == 1 {
+		return nil, s.err
+	}
+	return &databasepb.Database{Name: req.Name, State: databasepb.Database_READY}, nil
+}
+
+func TestPollHonorsRetryDelay(t *testing.T) {
+	defer fastPoll()()
+	srv := &throttledServer{err: errWithRetryDelay(t, 50*time.Millisecond)}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	start := time.Now()
+	if _, err := c.AwaitDatabaseState(context.Background(), "db", databasepb.Database_READY, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("retried after %v, want at least the server delay of 50ms", d)
+	}
+	if srv.calls != 2 {
+		t.Errorf("got %d GetDatabase calls, want 2", srv.calls)
+	}
+}
+
+func TestExitCodeForError(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want int
+	}{
+		{nil, 0},
+		{status.Error(codes.InvalidArgument, "bad"), 2},
+		{status.Error(codes.NotFound, "gone"), 4},
+		{status.Error(codes.PermissionDenied, "no"), 77},
+		{status.Error(codes.Unauthenticated, "who"), 77},
+		{status.Error(codes.Unavailable, "down"), 1},
+		{errors.New("plain"), 1},
+	} {
+		if got := ExitCodeForError(test.err); got != test.want {
+			t.Errorf("ExitCodeForError(%v) = %d, want %d", test.err, got, test.want)
+		}
+	}
+}
+
+// getDatabaseErrServer fails every GetDatabase call with err.
+type getDatabaseErrServer struct {
+	mockDatabaseAdminServer
+	err error
+}
+
+func (s *getDatabaseErrServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &databasepb.Database{Name: req.Name, State: databasepb.Database_READY}, nil
+}
+
+func TestProbe(t *testing.T) {
+	const db = "projects/p/instances/i/databases/d"
+	withInfo, err := status.New(codes.NotFound, "not found").WithDetails(&edpb.ResourceInfo{
+		ResourceType: "type.googleapis.com/google.spanner.admin.instance.v1.Instance",
+		ResourceName: "projects/p/instances/i",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &getDatabaseErrServer{}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	for _, test := range []struct {
+		err  error
+		want error
+	}{
+		{nil, nil},
+		{withInfo.Err(), ErrInstanceNotFound},
+		{status.Error(codes.NotFound, "Instance not found: projects/p/instances/i"), ErrInstanceNotFound},
+		{status.Error(codes.NotFound, "Database not found: "+db), ErrDatabaseNotFound},
+	} {
+		srv.err = test.err
+		got := c.Probe(context.Background(), db)
+		if test.want == nil {
+			if got != nil {
+				t.Errorf("server error %v: got %v, want nil", test.err, got)
+			}
+			continue
+		}
+		nf, ok := got.(*NotFoundError)
+		if !ok || !nf.Is(test.want) {
+			t.Errorf("server error %v: got %v, want %v", test.err, got, test.want)
+			continue
+		}
+		if s, _ := status.FromError(got); s.Code() != codes.NotFound || s.Message() != status.Convert(test.err).Message() {
+			t.Errorf("server error %v: got status %v, want the server's", test.err, s)
+		}
+		if code := ExitCodeForError(got); code != 4 {
+			t.Errorf("server error %v: ExitCodeForError = %d, want 4", test.err, code)
+		}
+	}
+	if ErrInstanceNotFound.Is(ErrDatabaseNotFound) {
+		t.Error("ErrInstanceNotFound matches ErrDatabaseNotFound")
+	}
+	if code := status.Code(ErrDatabaseNotFound); code != codes.NotFound {
+		t.Errorf("status.Code(ErrDatabaseNotFound) = %v, want NotFound", code)
+	}
+
+	srv.err = status.Error(codes.PermissionDenied, "no")
+	if err := c.Probe(context.Background(), db); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("got %v, want PermissionDenied", err)
+	}
+	srv.err = nil
+	if err := c.Probe(context.Background(), "d"); err == nil {
+		t.Error("malformed name: got nil error, want error")
+	}
+}
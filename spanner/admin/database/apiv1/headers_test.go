@@ -0,0 +1,271 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	itestutil "cloud.google.com/go/internal/testutil"
+	"google.golang.org/api/option"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestParamsChecker checks that a request carries a single routing header
+// naming a resource.
+var requestParamsChecker = &itestutil.HeaderChecker{
+	Key: "x-goog-request-params",
+	ValuesValidator: func(values ...string) error {
+		if len(values) != 1 {
+			return errors.New("want exactly one value")
+		}
+		if i := strings.Index(values[0], "="); i <= 0 || i == len(values[0])-1 {
+			return errors.New("want key=value")
+		}
+		return nil
+	},
+}
+
+// TestRequestHeaders checks that every call made by the client, including
+// the calls made by the helpers in this package and through LROClient,
+// carries the client information and routing headers.
+func TestRequestHeaders(t *testing.T) {
+	enforcer := &itestutil.HeadersEnforcer{
+		OnFailure: t.Errorf,
+		Checkers:  []*itestutil.HeaderChecker{itestutil.XGoogClientHeaderChecker, requestParamsChecker},
+	}
+	// Every call fails without being retried; only the outgoing headers
+	// matter.
+	srv := &mockDatabaseAdminServer{err: status.Error(codes.FailedPrecondition, "headers only")}
+	c, stop := newServerClient(t, srv, enforcer.CallOptions()...)
+	defer stop()
+	defer c.Close()
+
+	const (
+		parent = "projects/p/instances/i"
+		db     = parent + "/databases/d"
+	)
+	ctx := context.Background()
+	for _, call := range []struct {
+		name string
+		f    func() error
+	}{
+		{"CreateDatabase", func() error {
+			_, err := c.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{Parent: parent, CreateStatement: "CREATE DATABASE d"})
+			return err
+		}},
+		{"GetDatabase", func() error {
+			_, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: db})
+			return err
+		}},
+		{"UpdateDatabaseDdl", func() error {
+			_, err := c.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{Database: db, Statements: []string{"DROP TABLE A"}})
+			return err
+		}},
+		{"DropDatabase", func() error {
+			return c.DropDatabase(ctx, &databasepb.DropDatabaseRequest{Database: db})
+		}},
+		{"GetDatabaseDdl", func() error {
+			_, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: db})
+			return err
+		}},
+		{"SetIamPolicy", func() error {
+			_, err := c.SetIamPolicy(ctx, &iampb.SetIamPolicyRequest{Resource: db, Policy: &iampb.Policy{}})
+			return err
+		}},
+		{"GetIamPolicy", func() error {
+			_, err := c.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: db})
+			return err
+		}},
+		{"TestIamPermissions", func() error {
+			_, err := c.TestIamPermissions(ctx, &iampb.TestIamPermissionsRequest{Resource: db})
+			return err
+		}},
+		{"ListDatabases", func() error {
+			_, err := c.ListDatabases(ctx, &databasepb.ListDatabasesRequest{Parent: parent}).Next()
+			return err
+		}},
+		{"LROClient.GetOperation", func() error {
+			_, err := c.LROClient.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: db + "/operations/op"})
+			return err
+		}},
+		{"ApplyDDL", func() error { return c.ApplyDDL(ctx, db, []string{"DROP TABLE A"}) }},
+		{"AddColumn", func() error { return c.AddColumn(ctx, db, "A", "y INT64") }},
+		{"DropAllTables", func() error { return c.DropAllTables(ctx, db) }},
+		{"ImportSchema", func() error {
+			_, err := c.ImportSchema(ctx, parent, "db", "CREATE TABLE A (x INT64) PRIMARY KEY (x)")
+			return err
+		}},
+		{"CreateDatabaseAndWaitWithOp", func() error {
+			_, _, err := c.CreateDatabaseAndWaitWithOp(ctx, &databasepb.CreateDatabaseRequest{Parent: parent, CreateStatement: "CREATE DATABASE d"})
+			return err
+		}},
+		{"AwaitDatabaseState", func() error {
+			_, err := c.AwaitDatabaseState(ctx, db, databasepb.Database_READY, 0)
+			return err
+		}},
+		{"SetIamPolicyAndVerify", func() error {
+			_, err := c.SetIamPolicyAndVerify(ctx, &iampb.SetIamPolicyRequest{Resource: db, Policy: &iampb.Policy{}})
+			return err
+		}},
+		{"LatestDDLOperation", func() error {
+			_, err := c.LatestDDLOperation(ctx, db)
+			return err
+		}},
+	} {
+		if err := call.f(); err == nil {
+			t.Errorf("%s: got nil error, want the server's error", call.name)
+		}
+	}
+
+	// The migration helpers only reach the data API when the schema can be
+	// read, so they run against a server that answers.
+	msrv := &migrationsServer{ddlServer: ddlServer{statements: singerStatements}}
+	mc, mstop := newServerClient(t, msrv, enforcer.CallOptions()...)
+	defer mstop()
+	defer mc.Close()
+	for _, call := range []struct {
+		name string
+		f    func() error
+	}{
+		{"ApplyMigration", func() error { return mc.ApplyMigration(ctx, db, "v1", []string{"DROP TABLE A"}) }},
+		{"AppliedMigrations", func() error {
+			msrv.statements = append(singerStatements, createMigrationsTable)
+			_, err := mc.AppliedMigrations(ctx, db)
+			return err
+		}},
+	} {
+		if err := call.f(); err != nil {
+			t.Errorf("%s: %v", call.name, err)
+		}
+	}
+}
+
+// routingRecorder records the method and routing header of each outgoing call.
+type routingRecorder struct {
+	mu    sync.Mutex
+	calls []string // "method: routing header"
+}
+
+func (r *routingRecorder) option() option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			r.mu.Lock()
+			r.calls = append(r.calls, method[strings.LastIndex(method, "/")+1:]+": "+strings.Join(md["x-goog-request-params"], ","))
+			r.mu.Unlock()
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}))
+}
+
+func (r *routingRecorder) take() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := r.calls
+	r.calls = nil
+	return calls
+}
+
+// TestHelperRoutingHeaders checks that the requests built by the helpers in
+// this package route to the resource they act on.
+func TestHelperRoutingHeaders(t *testing.T) {
+	var rec routingRecorder
+	srv := &mockDatabaseAdminServer{err: status.Error(codes.FailedPrecondition, "headers only")}
+	c, stop := newServerClient(t, srv, rec.option())
+	defer stop()
+	defer c.Close()
+
+	const (
+		parent = "projects/p/instances/i"
+		db     = parent + "/databases/d"
+	)
+	ctx := context.Background()
+	iamReq := &iampb.SetIamPolicyRequest{Resource: db, Policy: &iampb.Policy{}}
+	for _, test := range []struct {
+		name string
+		f    func()
+		want []string
+	}{
+		{"ApplyDDL", func() { c.ApplyDDL(ctx, db, []string{"DROP TABLE A"}) },
+			[]string{"UpdateDatabaseDdl: database=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd"}},
+		{"AddColumn", func() { c.AddColumn(ctx, db, "A", "y INT64") },
+			[]string{"UpdateDatabaseDdl: database=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd"}},
+		{"DropAllTables", func() { c.DropAllTables(ctx, db) },
+			[]string{"GetDatabaseDdl: database=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd"}},
+		{"ImportSchema", func() { c.ImportSchema(ctx, parent, "db", "CREATE TABLE A (x INT64) PRIMARY KEY (x)") },
+			[]string{"CreateDatabase: parent=projects%2Fp%2Finstances%2Fi"}},
+		{"AwaitDatabaseState", func() { c.AwaitDatabaseState(ctx, db, databasepb.Database_READY, 0) },
+			[]string{"GetDatabase: name=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd"}},
+		{"SetIamPolicyAndVerify", func() { c.SetIamPolicyAndVerify(ctx, iamReq) },
+			[]string{"SetIamPolicy: resource=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd"}},
+		{"LatestDDLOperation", func() { c.LatestDDLOperation(ctx, db) },
+			[]string{"ListOperations: name=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd%2Foperations"}},
+	} {
+		test.f()
+		if got := rec.take(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got calls %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	msrv := &migrationsServer{ddlServer: ddlServer{statements: singerStatements}}
+	mc, mstop := newServerClient(t, msrv, rec.option())
+	defer mstop()
+	defer mc.Close()
+	const (
+		dbParam = "database=projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd"
+		session = "projects%2Fp%2Finstances%2Fi%2Fdatabases%2Fd%2Fsessions%2Fs"
+	)
+	for _, test := range []struct {
+		name string
+		f    func()
+		want []string
+	}{
+		{"ApplyMigration", func() { mc.ApplyMigration(ctx, db, "v1", []string{"DROP TABLE A"}) }, []string{
+			"GetDatabaseDdl: " + dbParam,
+			"UpdateDatabaseDdl: " + dbParam,
+			"CreateSession: " + dbParam,
+			"ExecuteSql: session=" + session + "1",
+			"DeleteSession: name=" + session + "1",
+			"UpdateDatabaseDdl: " + dbParam,
+			"CreateSession: " + dbParam,
+			"Commit: session=" + session + "2",
+			"DeleteSession: name=" + session + "2",
+		}},
+		{"AppliedMigrations", func() {
+			msrv.statements = append(singerStatements, createMigrationsTable)
+			mc.AppliedMigrations(ctx, db)
+		}, []string{
+			"GetDatabaseDdl: " + dbParam,
+			"CreateSession: " + dbParam,
+			"ExecuteSql: session=" + session + "3",
+			"DeleteSession: name=" + session + "3",
+		}},
+	} {
+		test.f()
+		if got := rec.take(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got calls %q, want %q", test.name, got, test.want)
+		}
+	}
+}
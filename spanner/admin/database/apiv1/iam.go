@@ -0,0 +1,143 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/internal/trace"
+	"github.com/golang/protobuf/proto"
+	gax "github.com/googleapis/gax-go/v2"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/grpc/status"
+)
+
+// iamVerifyTimeout bounds how long SetIamPolicyAndVerify waits for a policy
+// change to take effect when ctx has no deadline.
+var iamVerifyTimeout = 2 * time.Minute
+
+// SetIamPolicyAndVerify sets the access control policy on a database resource,
+// like SetIamPolicy, and then reads the policy back until its bindings match
+// the ones that were set. Bindings are compared as sets of members per role
+// and condition, so ordering differences are ignored.
+//
+// If ctx has no deadline, SetIamPolicyAndVerify waits at most two minutes for
+// the change to take effect. If it does not, an error is returned, although
+// the policy has been set.
+func (c *DatabaseAdminClient) SetIamPolicyAndVerify(ctx context.Context, req *iampb.SetIamPolicyRequest, opts ...gax.CallOption) (*iampb.Policy, error) {
+	policy, err := c.SetIamPolicy(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, iamVerifyTimeout)
+		defer cancel()
+	}
+	want := bindingSets(policy)
+	ctx = startWaitSpan(ctx, "SetIamPolicyAndVerify")
+	err = poll(ctx, func() (bool, error) {
+		got, err := c.GetIamPolicy(ctx, &iampb.GetIamPolicyRequest{Resource: req.Resource}, opts...)
+		if err != nil {
+			return false, err
+		}
+		return sameBindings(bindingSets(got), want), nil
+	})
+	trace.EndSpan(ctx, err)
+	if err != nil && ctx.Err() != nil {
+		return nil, status.Errorf(ctxErrCode(ctx), "database: policy on %s was set but the change was not observed: %v", req.Resource, ctx.Err())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// bindingSets returns the members of each binding in p, keyed by role and
+// condition expression.
+func bindingSets(p *iampb.Policy) map[string]map[string]bool {
+	sets := map[string]map[string]bool{}
+	for _, b := range p.GetBindings() {
+		if len(b.Members) == 0 {
+			continue
+		}
+		key := b.Role + "\x00" + b.GetCondition().GetExpression()
+		if sets[key] == nil {
+			sets[key] = map[string]bool{}
+		}
+		for _, m := range b.Members {
+			sets[key][m] = true
+		}
+	}
+	return sets
+}
+
+func sameBindings(a, b map[string]map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, am := range a {
+		bm := b[key]
+		if len(am) != len(bm) {
+			return false
+		}
+		for m := range am {
+			if !bm[m] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NormalizePolicy returns a copy of p with its bindings in a canonical order,
+// for stable diffs of policies: bindings without members are removed, the
+// remaining bindings are sorted by role and then by condition expression, and
+// the members of each binding are sorted with duplicates removed. p is not
+// modified.
+func NormalizePolicy(p *iampb.Policy) *iampb.Policy {
+	if p == nil {
+		return nil
+	}
+	n := proto.Clone(p).(*iampb.Policy)
+	bindings := n.Bindings[:0]
+	for _, b := range n.Bindings {
+		if len(b.Members) == 0 {
+			continue
+		}
+		sort.Strings(b.Members)
+		members := b.Members[:1]
+		for _, m := range b.Members[1:] {
+			if m != members[len(members)-1] {
+				members = append(members, m)
+			}
+		}
+		b.Members = members
+		bindings = append(bindings, b)
+	}
+	sort.SliceStable(bindings, func(i, j int) bool {
+		if bindings[i].Role != bindings[j].Role {
+			return bindings[i].Role < bindings[j].Role
+		}
+		return bindings[i].GetCondition().GetExpression() < bindings[j].GetCondition().GetExpression()
+	})
+	if len(bindings) == 0 {
+		bindings = nil
+	}
+	n.Bindings = bindings
+	return n
+}
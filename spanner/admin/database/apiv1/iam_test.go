@@ -0,0 +1,135 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	iampb "google.golang.org/genproto/googleapis/iam/v1"
+	"google.golang.org/genproto/googleapis/type/expr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// laggingIAMServer stores the policy set on it, but keeps returning the
+// previous policy from the first lag calls to GetIamPolicy that follow.
+type laggingIAMServer struct {
+	mockDatabaseAdminServer
+
+	mu       sync.Mutex
+	lag      int
+	old, cur *iampb.Policy
+	sinceSet int
+	getCalls int
+}
+
+func (s *laggingIAMServer) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.old, s.cur = s.cur, req.Policy
+	s.sinceSet = 0
+	return req.Policy, nil
+}
+
+func (s *laggingIAMServer) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.getCalls++
+	s.sinceSet++
+	if s.sinceSet <= s.lag {
+		return s.old, nil
+	}
+	// Return the bindings in a different order to what was set.
+	p := proto.Clone(s.cur).(*iampb.Policy)
+	for i, j := 0, len(p.Bindings)-1; i < j; i, j = i+1, j-1 {
+		p.Bindings[i], p.Bindings[j] = p.Bindings[j], p.Bindings[i]
+	}
+	return p, nil
+}
+
+var testPolicy = &iampb.Policy{Bindings: []*iampb.Binding{
+	{Role: "roles/spanner.databaseReader", Members: []string{"user:a@example.com", "user:b@example.com"}},
+	{Role: "roles/spanner.databaseUser", Members: []string{"group:g@example.com"}},
+}}
+
+func TestSetIamPolicyAndVerify(t *testing.T) {
+	defer fastPoll()()
+	srv := &laggingIAMServer{lag: 2, cur: &iampb.Policy{}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	got, err := c.SetIamPolicyAndVerify(context.Background(), &iampb.SetIamPolicyRequest{Resource: "db", Policy: testPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(got, testPolicy) {
+		t.Errorf("got %v, want %v", got, testPolicy)
+	}
+	if srv.getCalls != 3 {
+		t.Errorf("got %d GetIamPolicy calls, want 3", srv.getCalls)
+	}
+}
+
+func TestSetIamPolicyAndVerifyTimeout(t *testing.T) {
+	defer fastPoll()()
+	defer func(d time.Duration) { iamVerifyTimeout = d }(iamVerifyTimeout)
+	iamVerifyTimeout = 50 * time.Millisecond
+	srv := &laggingIAMServer{lag: 1 << 30, cur: &iampb.Policy{}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	_, err := c.SetIamPolicyAndVerify(context.Background(), &iampb.SetIamPolicyRequest{Resource: "db", Policy: testPolicy})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestNormalizePolicy(t *testing.T) {
+	p := &iampb.Policy{
+		Version: 3,
+		Etag:    []byte("etag"),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/spanner.databaseUser", Members: []string{"user:b@example.com", "user:a@example.com", "user:b@example.com"}},
+			{Role: "roles/spanner.databaseAdmin", Members: nil},
+			{Role: "roles/spanner.databaseReader", Members: []string{"group:g@example.com"}, Condition: &expr.Expr{Expression: "request.time < timestamp('2020-01-01T00:00:00Z')"}},
+			{Role: "roles/spanner.databaseReader", Members: []string{"user:c@example.com"}},
+		},
+	}
+	orig := proto.Clone(p)
+	want := &iampb.Policy{
+		Version: 3,
+		Etag:    []byte("etag"),
+		Bindings: []*iampb.Binding{
+			{Role: "roles/spanner.databaseReader", Members: []string{"user:c@example.com"}},
+			{Role: "roles/spanner.databaseReader", Members: []string{"group:g@example.com"}, Condition: &expr.Expr{Expression: "request.time < timestamp('2020-01-01T00:00:00Z')"}},
+			{Role: "roles/spanner.databaseUser", Members: []string{"user:a@example.com", "user:b@example.com"}},
+		},
+	}
+	if got := NormalizePolicy(p); !proto.Equal(got, want) {
+		t.Errorf("NormalizePolicy:\ngot  %v\nwant %v", got, want)
+	}
+	if !proto.Equal(p, orig) {
+		t.Errorf("NormalizePolicy modified its argument: %v", p)
+	}
+	if got := NormalizePolicy(nil); got != nil {
+		t.Errorf("NormalizePolicy(nil) = %v, want nil", got)
+	}
+}
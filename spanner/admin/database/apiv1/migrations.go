@@ -0,0 +1,180 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	vkit "cloud.google.com/go/spanner/apiv1"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/option"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	spannerpb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// MigrationsTable is the table ApplyMigration records applied migration
+// versions in.
+const MigrationsTable = "SchemaMigrations"
+
+const createMigrationsTable = "CREATE TABLE " + MigrationsTable + " (\n" +
+	"  Version STRING(MAX) NOT NULL,\n" +
+	"  AppliedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp=true),\n" +
+	") PRIMARY KEY(Version)"
+
+// ApplyMigration applies the DDL statements of the migration version to the
+// database databaseName and records version in MigrationsTable, creating
+// the table first if the database does not have it. If version is already
+// recorded, ApplyMigration does nothing.
+//
+// The version is recorded once the statements have been applied, so a
+// migration whose statements fail is not recorded and may be retried.
+// Concurrent callers applying the same version are not serialised; at most
+// one of them records it and the others get an AlreadyExists error.
+//
+// Migration versions are read and written with the Cloud Spanner data API
+// client, over the client's connection. opts apply to the admin calls only.
+func (c *DatabaseAdminClient) ApplyMigration(ctx context.Context, databaseName, version string, statements []string, opts ...gax.CallOption) error {
+	if version == "" {
+		return errors.New("database: empty migration version")
+	}
+	if err := checkDDLBatch(statements); err != nil {
+		return err
+	}
+	exists, err := c.hasMigrationsTable(ctx, databaseName, opts...)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := c.ApplyDDL(ctx, databaseName, []string{createMigrationsTable}, opts...); err != nil {
+			return err
+		}
+	}
+	var applied bool
+	err = c.withSession(ctx, databaseName, func(ctx context.Context, sc *vkit.Client, session string) error {
+		rs, err := sc.ExecuteSql(ctx, &spannerpb.ExecuteSqlRequest{
+			Session: session,
+			Sql:     "SELECT Version FROM " + MigrationsTable + " WHERE Version = @version",
+			Params: &structpb.Struct{Fields: map[string]*structpb.Value{
+				"version": stringValue(version),
+			}},
+			ParamTypes: map[string]*spannerpb.Type{"version": {Code: spannerpb.TypeCode_STRING}},
+		})
+		if err != nil {
+			return err
+		}
+		applied = len(rs.Rows) > 0
+		return nil
+	})
+	if err != nil || applied {
+		return err
+	}
+	if err := c.ApplyDDL(ctx, databaseName, statements, opts...); err != nil {
+		return err
+	}
+	// The schema change may take longer than an idle session lives, so the
+	// version is recorded in a new session.
+	return c.withSession(ctx, databaseName, func(ctx context.Context, sc *vkit.Client, session string) error {
+		_, err := sc.Commit(ctx, &spannerpb.CommitRequest{
+			Session: session,
+			Transaction: &spannerpb.CommitRequest_SingleUseTransaction{
+				SingleUseTransaction: &spannerpb.TransactionOptions{
+					Mode: &spannerpb.TransactionOptions_ReadWrite_{ReadWrite: &spannerpb.TransactionOptions_ReadWrite{}},
+				},
+			},
+			Mutations: []*spannerpb.Mutation{{
+				Operation: &spannerpb.Mutation_Insert{Insert: &spannerpb.Mutation_Write{
+					Table:   MigrationsTable,
+					Columns: []string{"Version", "AppliedAt"},
+					Values: []*structpb.ListValue{{Values: []*structpb.Value{
+						stringValue(version),
+						stringValue("spanner.commit_timestamp()"),
+					}}},
+				}},
+			}},
+		})
+		return err
+	})
+}
+
+// AppliedMigrations returns the migration versions recorded in
+// MigrationsTable of the database databaseName by ApplyMigration, in the
+// order they were applied. It returns no versions if the database does not
+// have the table.
+func (c *DatabaseAdminClient) AppliedMigrations(ctx context.Context, databaseName string, opts ...gax.CallOption) ([]string, error) {
+	exists, err := c.hasMigrationsTable(ctx, databaseName, opts...)
+	if err != nil || !exists {
+		return nil, err
+	}
+	var versions []string
+	err = c.withSession(ctx, databaseName, func(ctx context.Context, sc *vkit.Client, session string) error {
+		rs, err := sc.ExecuteSql(ctx, &spannerpb.ExecuteSqlRequest{
+			Session: session,
+			Sql:     "SELECT Version FROM " + MigrationsTable + " ORDER BY AppliedAt, Version",
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range rs.Rows {
+			versions = append(versions, row.GetValues()[0].GetStringValue())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// hasMigrationsTable reports whether the database databaseName has
+// MigrationsTable.
+func (c *DatabaseAdminClient) hasMigrationsTable(ctx context.Context, databaseName string, opts ...gax.CallOption) (bool, error) {
+	resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+	if err != nil {
+		return false, err
+	}
+	for _, stmt := range resp.Statements {
+		if o, ok := createdObject(stmt); ok && o.kind == "TABLE" && strings.EqualFold(o.name, MigrationsTable) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// withSession calls f with a data API client on c's connection and a session
+// of the database databaseName, which is deleted when f returns. The data
+// API client is not closed, as it shares c's connection.
+func (c *DatabaseAdminClient) withSession(ctx context.Context, databaseName string, f func(context.Context, *vkit.Client, string) error) error {
+	sc, err := vkit.NewClient(ctx, option.WithGRPCConn(c.Connection()))
+	if err != nil {
+		return err
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, "google-cloud-resource-prefix", databaseName)
+	s, err := sc.CreateSession(ctx, &spannerpb.CreateSessionRequest{Database: databaseName})
+	if err != nil {
+		return err
+	}
+	err = f(ctx, sc, s.Name)
+	// The session is garbage collected by the service if this fails.
+	sc.DeleteSession(ctx, &spannerpb.DeleteSessionRequest{Name: s.Name})
+	return err
+}
+
+func stringValue(s string) *structpb.Value {
+	return &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: s}}
+}
@@ -0,0 +1,212 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	structpb "github.com/golang/protobuf/ptypes/struct"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	spannerpb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// migrationsServer serves a database whose MigrationsTable holds versions.
+// If expireOnDDL is set, every schema change outlives the sessions open when
+// it starts.
+type migrationsServer struct {
+	ddlServer
+	spannerpb.UnimplementedSpannerServer
+
+	versions    []string
+	created     int             // sessions created
+	live        map[string]bool // sessions that may be used
+	expireOnDDL bool
+}
+
+// checkSession checks that a request for the resource name carries a
+// resource prefix header naming its database and, if session is set, that
+// session exists.
+func (s *migrationsServer) checkSession(ctx context.Context, name string, session bool) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if got := md.Get("google-cloud-resource-prefix"); len(got) != 1 || !strings.HasPrefix(name, got[0]) {
+		return status.Errorf(codes.InvalidArgument, "resource prefix %q for %s", got, name)
+	}
+	if session && !s.live[name] {
+		return status.Errorf(codes.NotFound, "Session not found: %s", name)
+	}
+	return nil
+}
+
+func (s *migrationsServer) UpdateDatabaseDdl(ctx context.Context, req *databasepb.UpdateDatabaseDdlRequest) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	if s.expireOnDDL {
+		s.live = nil
+	}
+	s.mu.Unlock()
+	return s.ddlServer.UpdateDatabaseDdl(ctx, req)
+}
+
+func (s *migrationsServer) CreateSession(ctx context.Context, req *spannerpb.CreateSessionRequest) (*spannerpb.Session, error) {
+	if err := s.checkSession(ctx, req.Database, false); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created++
+	name := fmt.Sprintf("%s/sessions/s%d", req.Database, s.created)
+	if s.live == nil {
+		s.live = make(map[string]bool)
+	}
+	s.live[name] = true
+	return &spannerpb.Session{Name: name}, nil
+}
+
+func (s *migrationsServer) DeleteSession(ctx context.Context, req *spannerpb.DeleteSessionRequest) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkSession(ctx, req.Name, true); err != nil {
+		return nil, err
+	}
+	delete(s.live, req.Name)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *migrationsServer) ExecuteSql(ctx context.Context, req *spannerpb.ExecuteSqlRequest) (*spannerpb.ResultSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkSession(ctx, req.Session, true); err != nil {
+		return nil, err
+	}
+	rs := &spannerpb.ResultSet{}
+	want := req.Params.GetFields()["version"].GetStringValue()
+	for _, v := range s.versions {
+		if !strings.Contains(req.Sql, "@version") || v == want {
+			rs.Rows = append(rs.Rows, &structpb.ListValue{Values: []*structpb.Value{stringValue(v)}})
+		}
+	}
+	return rs, nil
+}
+
+func (s *migrationsServer) Commit(ctx context.Context, req *spannerpb.CommitRequest) (*spannerpb.CommitResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkSession(ctx, req.Session, true); err != nil {
+		return nil, err
+	}
+	for _, m := range req.Mutations {
+		ins := m.GetInsert()
+		if ins.GetTable() != MigrationsTable {
+			return nil, status.Errorf(codes.InvalidArgument, "mutation %v", m)
+		}
+		for _, row := range ins.Values {
+			s.versions = append(s.versions, row.Values[0].GetStringValue())
+		}
+	}
+	return &spannerpb.CommitResponse{}, nil
+}
+
+func TestApplyMigration(t *testing.T) {
+	srv := &migrationsServer{ddlServer: ddlServer{statements: singerStatements}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+	ctx := context.Background()
+
+	v1 := []string{"CREATE TABLE A (Id INT64) PRIMARY KEY (Id)"}
+	if err := c.ApplyMigration(ctx, "db", "v1", v1); err != nil {
+		t.Fatal(err)
+	}
+	// The server does not apply the DDL itself.
+	srv.statements = append(srv.statements, createMigrationsTable)
+	if err := c.ApplyMigration(ctx, "db", "v1", v1); err != nil {
+		t.Fatal(err)
+	}
+	v2 := []string{"CREATE TABLE B (Id INT64) PRIMARY KEY (Id)"}
+	if err := c.ApplyMigration(ctx, "db", "v2", v2); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{createMigrationsTable}, v1, v2}; !reflect.DeepEqual(srv.updates, want) {
+		t.Errorf("got updates\n%q\nwant\n%q", srv.updates, want)
+	}
+	if want := []string{"v1", "v2"}; !reflect.DeepEqual(srv.versions, want) {
+		t.Errorf("got versions %q, want %q", srv.versions, want)
+	}
+	if len(srv.live) != 0 {
+		t.Errorf("sessions left open: %v", srv.live)
+	}
+	if err := c.ApplyMigration(ctx, "db", "", v1); err == nil {
+		t.Error("got nil error for an empty version")
+	}
+}
+
+func TestApplyMigrationSessionExpires(t *testing.T) {
+	srv := &migrationsServer{
+		ddlServer:   ddlServer{statements: append(singerStatements, createMigrationsTable)},
+		expireOnDDL: true,
+	}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	v1 := []string{"CREATE INDEX SlowBackfill ON Singers (FirstName)"}
+	if err := c.ApplyMigration(context.Background(), "db", "v1", v1); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]string{v1}; !reflect.DeepEqual(srv.updates, want) {
+		t.Errorf("got updates\n%q\nwant\n%q", srv.updates, want)
+	}
+	if want := []string{"v1"}; !reflect.DeepEqual(srv.versions, want) {
+		t.Errorf("got versions %q, want %q", srv.versions, want)
+	}
+}
+
+func TestAppliedMigrations(t *testing.T) {
+	srv := &migrationsServer{ddlServer: ddlServer{statements: singerStatements}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+	ctx := context.Background()
+
+	got, err := c.AppliedMigrations(ctx, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 0 {
+		t.Errorf("got versions %q without a migrations table, want none", got)
+	}
+
+	srv.statements = append(srv.statements, createMigrationsTable)
+	srv.versions = []string{"v1", "v2"}
+	got, err = c.AppliedMigrations(ctx, "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"v1", "v2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got versions %q, want %q", got, want)
+	}
+	if len(srv.live) != 0 {
+		t.Errorf("sessions left open: %v", srv.live)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// parseDatabaseName splits a database name of the form
+// projects/{project}/instances/{instance}/databases/{database} into the name
+// of its instance and the database ID.
+func parseDatabaseName(name string) (instance, database string, err error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 6 || parts[0] != "projects" || parts[2] != "instances" || parts[4] != "databases" ||
+		parts[1] == "" || parts[3] == "" || parts[5] == "" {
+		return "", "", fmt.Errorf("database: invalid database name %q, want projects/{project}/instances/{instance}/databases/{database}", name)
+	}
+	return strings.Join(parts[:4], "/"), parts[5], nil
+}
+
+// validateDatabaseID returns an error if id is not a valid database ID: 2 to
+// 30 characters, starting with a lower-case letter, continuing with
+// lower-case letters, digits, underscores and hyphens, and not ending with an
+// underscore or hyphen.
+func validateDatabaseID(id string) error {
+	if len(id) < 2 || len(id) > 30 {
+		return fmt.Errorf("database: database ID %q must be 2 to 30 characters long", id)
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		ok := 'a' <= ch && ch <= 'z' ||
+			i > 0 && ('0' <= ch && ch <= '9' || i < len(id)-1 && (ch == '_' || ch == '-'))
+		if !ok {
+			return fmt.Errorf("database: invalid database ID %q", id)
+		}
+	}
+	return nil
+}
+
+// ValidateCreateStatement returns an error unless stmt is a CREATE DATABASE
+// statement for a valid database ID and, if expectedID is not empty, that ID
+// is expectedID. Call it on CreateDatabaseRequest.CreateStatement before
+// calling CreateDatabase to catch a statement that names the wrong database.
+func ValidateCreateStatement(stmt, expectedID string) error {
+	id, ok := createDatabaseID(stmt)
+	if !ok {
+		return fmt.Errorf("database: %q is not a CREATE DATABASE statement", stmt)
+	}
+	if err := validateDatabaseID(id); err != nil {
+		return err
+	}
+	if expectedID != "" && id != expectedID {
+		return fmt.Errorf("database: CREATE DATABASE statement names database %q, want %q", id, expectedID)
+	}
+	return nil
+}
+
+// kmsKeyFormat is the format of a Cloud KMS key name.
+const kmsKeyFormat = "projects/{project}/locations/{location}/keyRings/{key_ring}/cryptoKeys/{crypto_key}"
+
+// ValidateKMSKeyName returns an error if name is not the name of a Cloud KMS
+// key, of the form
+// projects/{project}/locations/{location}/keyRings/{key_ring}/cryptoKeys/{crypto_key},
+// optionally followed by /cryptoKeyVersions/{version} to name a particular
+// version of the key. It checks only the form of the name, not that the key
+// exists.
+func ValidateKMSKeyName(name string) error {
+	bad := fmt.Errorf("database: invalid KMS key name %q, want %s[/cryptoKeyVersions/{version}]", name, kmsKeyFormat)
+	parts := strings.Split(name, "/")
+	if len(parts) != 8 && len(parts) != 10 {
+		return bad
+	}
+	for i, want := range []string{"projects", "locations", "keyRings", "cryptoKeys", "cryptoKeyVersions"} {
+		if 2*i < len(parts) && (parts[2*i] != want || parts[2*i+1] == "") {
+			return bad
+		}
+	}
+	return nil
+}
+
+// maxDerivedIDPrefix bounds the part of a derived operation ID taken from its
+// input.
+const maxDerivedIDPrefix = 40
+
+// DeriveDDLOperationID returns a schema update operation ID derived from
+// migrationVersion, for use as UpdateDatabaseDdlRequest.OperationId. The ID
+// is the same for the same input and valid for any input: it starts with
+// "m_", continues with a lower-cased prefix of migrationVersion in which
+// characters other than letters, digits and underscores are replaced by
+// underscores, and ends with part of a SHA-256 hash of migrationVersion, so
+// that inputs that only differ in replaced characters get different IDs.
+//
+// Submitting a migration's statements under its derived ID makes a repeated
+// submission fail with AlreadyExists instead of applying them twice.
+func DeriveDDLOperationID(migrationVersion string) string {
+	var b strings.Builder
+	b.WriteString("m_")
+	for i := 0; i < len(migrationVersion) && i < maxDerivedIDPrefix; i++ {
+		ch := migrationVersion[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z':
+			b.WriteByte(ch - 'A' + 'a')
+		case isIdentChar(ch):
+			b.WriteByte(ch)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	sum := sha256.Sum256([]byte(migrationVersion))
+	b.WriteByte('_')
+	b.WriteString(hex.EncodeToString(sum[:8]))
+	return b.String()
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestValidateKMSKeyName(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		ok   bool
+	}{
+		{"projects/p/locations/us-central1/keyRings/r/cryptoKeys/k", true},
+		{"projects/p/locations/us-central1/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", true},
+		{"", false},
+		{"projects/p/locations/us-central1/keyRings/r", false},
+		{"projects/p/locations/us-central1/keyRings/r/cryptoKeys/", false},
+		{"projects/p/locations/us-central1/keyRing/r/cryptoKeys/k", false},
+		{"projects/p/locations/us-central1/keyRings/r/cryptoKeys/k/versions/1", false},
+		{"projects/p/locations/us-central1/keyRings/r/cryptoKeys/k/cryptoKeyVersions", false},
+		{"/projects/p/locations/l/keyRings/r/cryptoKeys/k", false},
+	} {
+		err := ValidateKMSKeyName(test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("ValidateKMSKeyName(%q) = %v, want ok=%t", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestParseDatabaseName(t *testing.T) {
+	inst, db, err := parseDatabaseName("projects/p/instances/i/databases/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst != "projects/p/instances/i" || db != "d" {
+		t.Errorf("got (%q, %q), want (projects/p/instances/i, d)", inst, db)
+	}
+	for _, name := range []string{
+		"",
+		"d",
+		"projects/p/instances/i",
+		"projects/p/instances/i/databases/",
+		"projects/p/instances//databases/d",
+		"projects/p/instance/i/databases/d",
+		"projects/p/instances/i/databases/d/operations/o",
+	} {
+		if _, _, err := parseDatabaseName(name); err == nil {
+			t.Errorf("parseDatabaseName(%q): got nil error, want error", name)
+		}
+	}
+}
+
+func TestDeriveDDLOperationID(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	seen := map[string]string{}
+	for _, v := range []string{"", "v1", "V1", "v1.2", "v1_2", "2019-11-01 add Singers", strings.Repeat("x", 300), "héllo"} {
+		id := DeriveDDLOperationID(v)
+		if !valid.MatchString(id) {
+			t.Errorf("DeriveDDLOperationID(%q) = %q, not a valid operation ID", v, id)
+		}
+		if len(id) > 64 {
+			t.Errorf("DeriveDDLOperationID(%q) = %q, longer than 64 characters", v, id)
+		}
+		if other, ok := seen[id]; ok {
+			t.Errorf("DeriveDDLOperationID(%q) = DeriveDDLOperationID(%q) = %q", v, other, id)
+		}
+		seen[id] = v
+		if again := DeriveDDLOperationID(v); again != id {
+			t.Errorf("DeriveDDLOperationID(%q) = %q, then %q", v, id, again)
+		}
+	}
+	if got, want := DeriveDDLOperationID("v1.2")[:7], "m_v1_2_"; got != want {
+		t.Errorf("DeriveDDLOperationID(v1.2) starts with %q, want %q", got, want)
+	}
+}
+
+func TestValidateCreateStatement(t *testing.T) {
+	for _, test := range []struct {
+		stmt, expected string
+		ok             bool
+	}{
+		{"CREATE DATABASE orders", "", true},
+		{"CREATE DATABASE orders", "orders", true},
+		{"create database `prod-orders`", "prod-orders", true},
+		{"CREATE DATABASE `orders_2019`", "orders_2019", true},
+		{"CREATE DATABASE orders", "order", false},
+		{"CREATE DATABASE `orders`", "orders2", false},
+		{"CREATE TABLE orders (x INT64) PRIMARY KEY (x)", "", false},
+		{"CREATE DATABASE", "", false},
+		{"CREATE DATABASE `Orders`", "", false},
+		{"CREATE DATABASE `orders-`", "", false},
+		{"CREATE DATABASE `2orders`", "", false},
+		{"CREATE DATABASE o", "", false},
+		{"CREATE DATABASE `" + strings.Repeat("o", 31) + "`", "", false},
+	} {
+		err := ValidateCreateStatement(test.stmt, test.expected)
+		if (err == nil) != test.ok {
+			t.Errorf("ValidateCreateStatement(%q, %q) = %v, want ok=%t", test.stmt, test.expected, err, test.ok)
+		}
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	for _, test := range []struct {
+		ident, want string
+	}{
+		{"Singers", "`Singers`"},
+		{"Order", "`Order`"},
+		{"a_1", "`a_1`"},
+		{"", ""},
+		{"1a", ""},
+		{"_a", ""},
+		{"a`b", ""},
+		{"a; DROP TABLE b", ""},
+		{strings.Repeat("a", 129), ""},
+	} {
+		got, err := QuoteIdentifier(test.ident)
+		if got != test.want || (err == nil) != (test.want != "") {
+			t.Errorf("QuoteIdentifier(%q) = %q, %v, want %q", test.ident, got, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"cloud.google.com/go/internal/trace"
+	"cloud.google.com/go/longrunning"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrNoOperation is returned by helpers that look up a particular operation
+// when no matching operation exists. Operations are only retained by the
+// service for a limited time after they complete.
+var ErrNoOperation = errors.New("database: no matching operation")
+
+// ErrStopIteration may be returned by the function passed to
+// ForEachDatabaseOperation to stop the iteration early without an error.
+var ErrStopIteration = errors.New("database: stop iteration")
+
+// operationTypes maps the metadata message of each kind of database admin
+// operation to a label for the operation.
+var operationTypes = map[string]string{
+	"google.spanner.admin.database.v1.CreateDatabaseMetadata":           "CreateDatabase",
+	"google.spanner.admin.database.v1.UpdateDatabaseDdlMetadata":        "UpdateDatabaseDdl",
+	"google.spanner.admin.database.v1.CreateBackupMetadata":             "CreateBackup",
+	"google.spanner.admin.database.v1.CopyBackupMetadata":               "CopyBackup",
+	"google.spanner.admin.database.v1.RestoreDatabaseMetadata":          "RestoreDatabase",
+	"google.spanner.admin.database.v1.OptimizeRestoredDatabaseMetadata": "OptimizeRestoredDatabase",
+}
+
+// OperationType returns a label for the kind of operation op is, derived
+// from the type of its metadata: one of "CreateDatabase",
+// "UpdateDatabaseDdl", "CreateBackup", "CopyBackup", "RestoreDatabase" or
+// "OptimizeRestoredDatabase". It returns the empty string if op has no
+// metadata or the metadata is of any other type.
+//
+// Backup and restore operations are recognised even though this version of
+// the client has no methods that start them.
+func OperationType(op *longrunningpb.Operation) string {
+	if op.GetMetadata() == nil {
+		return ""
+	}
+	name, err := ptypes.AnyMessageName(op.Metadata)
+	if err != nil {
+		return ""
+	}
+	return operationTypes[name]
+}
+
+// DecodeOperationMetadata returns the metadata of op, unmarshalled into a
+// message of its concrete type, such as *databasepb.CreateDatabaseMetadata or
+// *databasepb.UpdateDatabaseDdlMetadata. It returns an error if op has no
+// metadata or if the metadata's type is not linked into the program, as is
+// the case for backup and restore metadata in this version of the client.
+func DecodeOperationMetadata(op *longrunningpb.Operation) (proto.Message, error) {
+	if op.GetMetadata() == nil {
+		return nil, fmt.Errorf("database: operation %q has no metadata", op.GetName())
+	}
+	var m ptypes.DynamicAny
+	if err := ptypes.UnmarshalAny(op.Metadata, &m); err != nil {
+		return nil, fmt.Errorf("database: decoding metadata of operation %q: %v", op.GetName(), err)
+	}
+	return m.Message, nil
+}
+
+// OperationToJSON returns op as indented JSON, for logging. The metadata and
+// response of op are written out field by field under their concrete types,
+// as DecodeOperationMetadata would decode them, rather than as encoded
+// bytes. It returns an error if they are of a type that is not linked into
+// the program.
+func OperationToJSON(op *longrunningpb.Operation) (string, error) {
+	m := jsonpb.Marshaler{Indent: "  "}
+	s, err := m.MarshalToString(op)
+	if err != nil {
+		return "", fmt.Errorf("database: encoding operation %q: %v", op.GetName(), err)
+	}
+	return s, nil
+}
+
+// listDatabaseOperations calls fn for each operation of the database
+// databaseName, in the order the service returns them, until fn returns a
+// non-nil error.
+func (c *DatabaseAdminClient) listDatabaseOperations(ctx context.Context, databaseName string, fn func(*longrunningpb.Operation) error, opts ...gax.CallOption) error {
+	it := c.LROClient.ListOperations(ctx, &longrunningpb.ListOperationsRequest{
+		Name: databaseName + "/operations",
+	}, opts...)
+	for {
+		op, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(op); err != nil {
+			return err
+		}
+	}
+}
+
+// ForEachDatabaseOperation calls fn for each operation of each database in
+// the instance instancePath, a database at a time in the order ListDatabases
+// returns them, fetching operations a page at a time. It stops at the first
+// error from fn and returns it, unless the error is ErrStopIteration, in
+// which case it returns nil.
+//
+// This version of the API has no instance-wide operation listing, so each
+// database's operations are listed separately.
+func (c *DatabaseAdminClient) ForEachDatabaseOperation(ctx context.Context, instancePath string, fn func(*longrunningpb.Operation) error, opts ...gax.CallOption) error {
+	it := c.ListDatabases(ctx, &databasepb.ListDatabasesRequest{Parent: instancePath}, opts...)
+	for {
+		db, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = c.listDatabaseOperations(ctx, db.Name, fn, opts...)
+		if err == ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// ResumableOp is an operation that was still running when
+// ResumableOperations found it, for resuming tracking of the operation after
+// a restart.
+type ResumableOp struct {
+	Name string
+	// Type is the kind of operation, as reported by OperationType.
+	Type string
+
+	lro *longrunning.Operation
+}
+
+// Wait blocks until the operation is done or ctx is done, and returns the
+// operation's error, if any.
+func (op ResumableOp) Wait(ctx context.Context, opts ...gax.CallOption) error {
+	return op.lro.Wait(ctx, nil, opts...)
+}
+
+// Poll fetches the latest state of the operation. It returns the operation's
+// error if it has failed, and nil while it is running or once it has
+// succeeded; use Done to tell the last two apart.
+func (op ResumableOp) Poll(ctx context.Context, opts ...gax.CallOption) error {
+	return op.lro.Poll(ctx, nil, opts...)
+}
+
+// Done reports whether the operation had finished when it was last polled.
+func (op ResumableOp) Done() bool {
+	return op.lro.Done()
+}
+
+// ResumableOperations returns the operations of the databases in the
+// instance instancePath that are still running, in the order
+// ForEachDatabaseOperation visits them, so that a restarted program can wait
+// for the operations it started before.
+func (c *DatabaseAdminClient) ResumableOperations(ctx context.Context, instancePath string, opts ...gax.CallOption) ([]ResumableOp, error) {
+	var ops []ResumableOp
+	err := c.ForEachDatabaseOperation(ctx, instancePath, func(op *longrunningpb.Operation) error {
+		if !op.Done {
+			ops = append(ops, ResumableOp{
+				Name: op.Name,
+				Type: OperationType(op),
+				lro:  longrunning.InternalNewOperation(c.LROClient, op),
+			})
+		}
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+// LatestDDLOperation returns the most recent schema change operation
+// (UpdateDatabaseDdl) of the database databaseName, or ErrNoOperation if
+// there is none.
+//
+// Schema change operations do not record when they started, so they are
+// ordered by the commit timestamp of their last committed statement. An
+// operation that is still running and has not committed any statement yet is
+// considered more recent than any operation that has.
+func (c *DatabaseAdminClient) LatestDDLOperation(ctx context.Context, databaseName string, opts ...gax.CallOption) (*longrunningpb.Operation, error) {
+	var (
+		latest     *longrunningpb.Operation
+		latestTime int64 // Unix nanoseconds of the last commit.
+	)
+	err := c.listDatabaseOperations(ctx, databaseName, func(op *longrunningpb.Operation) error {
+		if !ptypes.Is(op.Metadata, &databasepb.UpdateDatabaseDdlMetadata{}) {
+			return nil
+		}
+		var meta databasepb.UpdateDatabaseDdlMetadata
+		if err := ptypes.UnmarshalAny(op.Metadata, &meta); err != nil {
+			return err
+		}
+		var t int64
+		if ts := meta.CommitTimestamps; len(ts) > 0 {
+			ct, err := ptypes.Timestamp(ts[len(ts)-1])
+			if err != nil {
+				return err
+			}
+			t = ct.UnixNano()
+		} else if !op.Done {
+			t = math.MaxInt64
+		}
+		if latest == nil || t > latestTime {
+			latest, latestTime = op, t
+		}
+		return nil
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, ErrNoOperation
+	}
+	return latest, nil
+}
+
+// CreationOperation returns the CreateDatabase operation that created the
+// database databaseName, or ErrNoOperation if the service no longer has it.
+// This version of the API cannot restore databases from backups, so every
+// database was made by CreateDatabase.
+func (c *DatabaseAdminClient) CreationOperation(ctx context.Context, databaseName string, opts ...gax.CallOption) (*longrunningpb.Operation, error) {
+	var found *longrunningpb.Operation
+	err := c.listDatabaseOperations(ctx, databaseName, func(op *longrunningpb.Operation) error {
+		if !ptypes.Is(op.Metadata, &databasepb.CreateDatabaseMetadata{}) {
+			return nil
+		}
+		var meta databasepb.CreateDatabaseMetadata
+		if err := ptypes.UnmarshalAny(op.Metadata, &meta); err != nil {
+			return err
+		}
+		if meta.Database != databaseName {
+			return nil
+		}
+		found = op
+		return ErrStopIteration
+	}, opts...)
+	if err != nil && err != ErrStopIteration {
+		return nil, err
+	}
+	if found == nil {
+		return nil, ErrNoOperation
+	}
+	return found, nil
+}
+
+// PrepareDatabaseForDrop makes way for dropping the database databaseName:
+// it cancels the database's running schema changes and waits until all of
+// its operations have finished. Cancelling a schema change does not undo the
+// statements it has already committed.
+//
+// Operations other than schema changes cannot be cancelled, so they are
+// waited for. If ctx is done first, PrepareDatabaseForDrop returns an error
+// with the corresponding code.
+func (c *DatabaseAdminClient) PrepareDatabaseForDrop(ctx context.Context, databaseName string, opts ...gax.CallOption) error {
+	var pending []string
+	err := c.listDatabaseOperations(ctx, databaseName, func(op *longrunningpb.Operation) error {
+		if op.Done {
+			return nil
+		}
+		if ptypes.Is(op.Metadata, &databasepb.UpdateDatabaseDdlMetadata{}) {
+			err := c.LROClient.CancelOperation(ctx, &longrunningpb.CancelOperationRequest{Name: op.Name}, opts...)
+			// The operation may have finished since it was listed.
+			if code := status.Code(err); code != codes.OK && code != codes.FailedPrecondition && code != codes.NotFound {
+				return err
+			}
+		}
+		pending = append(pending, op.Name)
+		return nil
+	}, opts...)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	ctx = startWaitSpan(ctx, "PrepareDatabaseForDrop")
+	err = poll(ctx, func() (bool, error) {
+		for len(pending) > 0 {
+			op, err := c.LROClient.GetOperation(ctx, &longrunningpb.GetOperationRequest{Name: pending[0]}, opts...)
+			if status.Code(err) != codes.NotFound {
+				if err != nil {
+					return false, err
+				}
+				if !op.Done {
+					return false, nil
+				}
+			}
+			pending = pending[1:]
+		}
+		return true, nil
+	})
+	trace.EndSpan(ctx, err)
+	if err != nil && ctx.Err() != nil {
+		return status.Errorf(ctxErrCode(ctx), "database: %d operations of %s still running: %v", len(pending), databaseName, ctx.Err())
+	}
+	return err
+}
@@ -0,0 +1,381 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	anypb "github.com/golang/protobuf/ptypes/any"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// opsServer serves a set of operations through the Operations service.
+type opsServer struct {
+	mockDatabaseAdminServer
+
+	mu       sync.Mutex
+	ops      []*longrunningpb.Operation
+	pageSize int
+	canceled []string
+}
+
+func (s *opsServer) ListOperations(ctx context.Context, req *longrunningpb.ListOperationsRequest) (*longrunningpb.ListOperationsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var matched []*longrunningpb.Operation
+	for _, op := range s.ops {
+		if strings.HasPrefix(op.Name, req.Name+"/") {
+			matched = append(matched, op)
+		}
+	}
+	start := 0
+	if req.PageToken != "" {
+		var err error
+		if start, err = strconv.Atoi(req.PageToken); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "bad page token %q", req.PageToken)
+		}
+	}
+	end := len(matched)
+	if s.pageSize > 0 && start+s.pageSize < end {
+		end = start + s.pageSize
+	}
+	resp := &longrunningpb.ListOperationsResponse{Operations: matched[start:end]}
+	if end < len(matched) {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+func (s *opsServer) GetOperation(ctx context.Context, req *longrunningpb.GetOperationRequest) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, op := range s.ops {
+		if op.Name == req.Name {
+			return op, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "operation %s not found", req.Name)
+}
+
+func (s *opsServer) CancelOperation(ctx context.Context, req *longrunningpb.CancelOperationRequest) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, op := range s.ops {
+		if op.Name == req.Name {
+			s.canceled = append(s.canceled, req.Name)
+			op = proto.Clone(op).(*longrunningpb.Operation)
+			op.Done = true
+			op.Result = &longrunningpb.Operation_Error{Error: status.New(codes.Canceled, "canceled").Proto()}
+			s.ops[i] = op
+			return &emptypb.Empty{}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "operation %s not found", req.Name)
+}
+
+func (s *opsServer) DeleteOperation(ctx context.Context, req *longrunningpb.DeleteOperationRequest) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "DeleteOperation")
+}
+
+func (s *opsServer) WaitOperation(ctx context.Context, req *longrunningpb.WaitOperationRequest) (*longrunningpb.Operation, error) {
+	return nil, status.Error(codes.Unimplemented, "WaitOperation")
+}
+
+// newOp returns an operation with the given name and metadata.
+func newOp(t *testing.T, name string, done bool, meta proto.Message) *longrunningpb.Operation {
+	any, err := ptypes.MarshalAny(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &longrunningpb.Operation{Name: name, Done: done, Metadata: any}
+}
+
+// ddlMeta returns UpdateDatabaseDdlMetadata with one statement committed at
+// each of the given times.
+func ddlMeta(t *testing.T, database string, commits ...time.Time) *databasepb.UpdateDatabaseDdlMetadata {
+	meta := &databasepb.UpdateDatabaseDdlMetadata{Database: database}
+	for i, ct := range commits {
+		ts, err := ptypes.TimestampProto(ct)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta.Statements = append(meta.Statements, "CREATE TABLE T"+strconv.Itoa(i)+" (x INT64) PRIMARY KEY (x)")
+		meta.CommitTimestamps = append(meta.CommitTimestamps, ts)
+	}
+	return meta
+}
+
+func TestLatestDDLOperation(t *testing.T) {
+	const db = "projects/p/instances/i/databases/d"
+	t0 := time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)
+	srv := &opsServer{pageSize: 1, ops: []*longrunningpb.Operation{
+		newOp(t, db+"/operations/create", true, &databasepb.CreateDatabaseMetadata{Database: db}),
+		newOp(t, db+"/operations/old", true, ddlMeta(t, db, t0)),
+		newOp(t, db+"/operations/new", true, ddlMeta(t, db, t0, t0.Add(time.Hour))),
+		newOp(t, db+"/operations/mid", true, ddlMeta(t, db, t0.Add(time.Minute))),
+		newOp(t, db+"2/operations/other", false, ddlMeta(t, db+"2")),
+	}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	op, err := c.LatestDDLOperation(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := op.Name, db+"/operations/new"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	srv.ops = append(srv.ops, newOp(t, db+"/operations/pending", false, ddlMeta(t, db)))
+	op, err = c.LatestDDLOperation(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := op.Name, db+"/operations/pending"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if _, err := c.LatestDDLOperation(context.Background(), db+"3"); err != ErrNoOperation {
+		t.Errorf("got %v, want ErrNoOperation", err)
+	}
+}
+
+func TestCreationOperation(t *testing.T) {
+	const db = "projects/p/instances/i/databases/d"
+	srv := &opsServer{pageSize: 1, ops: []*longrunningpb.Operation{
+		newOp(t, db+"/operations/ddl", true, ddlMeta(t, db)),
+		newOp(t, db+"/operations/create", true, &databasepb.CreateDatabaseMetadata{Database: db}),
+		newOp(t, db+"2/operations/create", true, &databasepb.CreateDatabaseMetadata{Database: db + "2"}),
+		newOp(t, db+"3/operations/ddl", true, ddlMeta(t, db+"3")),
+	}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	op, err := c.CreationOperation(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := op.Name, db+"/operations/create"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := c.CreationOperation(context.Background(), db+"3"); err != ErrNoOperation {
+		t.Errorf("got %v, want ErrNoOperation", err)
+	}
+}
+
+func TestOperationType(t *testing.T) {
+	for _, test := range []struct {
+		op   *longrunningpb.Operation
+		want string
+	}{
+		{nil, ""},
+		{&longrunningpb.Operation{Name: "no-metadata"}, ""},
+		{newOp(t, "op", true, &databasepb.CreateDatabaseMetadata{}), "CreateDatabase"},
+		{newOp(t, "op", true, &databasepb.UpdateDatabaseDdlMetadata{}), "UpdateDatabaseDdl"},
+		{newOp(t, "op", true, &databasepb.Database{}), ""},
+		{&longrunningpb.Operation{Metadata: &anypb.Any{
+			TypeUrl: "type.googleapis.com/google.spanner.admin.database.v1.RestoreDatabaseMetadata",
+		}}, "RestoreDatabase"},
+	} {
+		if got := OperationType(test.op); got != test.want {
+			t.Errorf("OperationType(%v) = %q, want %q", test.op, got, test.want)
+		}
+	}
+}
+
+func TestDecodeOperationMetadata(t *testing.T) {
+	meta := ddlMeta(t, "db", time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC))
+	got, err := DecodeOperationMetadata(newOp(t, "op", true, meta))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(*databasepb.UpdateDatabaseDdlMetadata); !ok || !proto.Equal(got, meta) {
+		t.Errorf("got %T %v, want %v", got, got, meta)
+	}
+
+	for _, op := range []*longrunningpb.Operation{
+		nil,
+		{Name: "no-metadata"},
+		{Name: "unknown", Metadata: &anypb.Any{
+			TypeUrl: "type.googleapis.com/google.spanner.admin.database.v1.RestoreDatabaseMetadata",
+		}},
+	} {
+		if m, err := DecodeOperationMetadata(op); err == nil {
+			t.Errorf("DecodeOperationMetadata(%v) = %v, want error", op, m)
+		}
+	}
+}
+
+func TestOperationToJSON(t *testing.T) {
+	const db = "projects/p/instances/i/databases/d"
+	op := newOp(t, db+"/operations/op", true, ddlMeta(t, db, time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)))
+	op.Result = doneOp(t, &emptypb.Empty{}).Result
+	got, err := OperationToJSON(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`"@type": "type.googleapis.com/google.spanner.admin.database.v1.UpdateDatabaseDdlMetadata"`,
+		`"database": "` + db + `"`,
+		`"commitTimestamps": [`,
+		`"2019-11-01T00:00:00Z"`,
+		`"done": true`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("JSON does not contain %s:\n%s", want, got)
+		}
+	}
+
+	op.Metadata = &anypb.Any{TypeUrl: "type.googleapis.com/google.spanner.admin.database.v1.RestoreDatabaseMetadata"}
+	if _, err := OperationToJSON(op); err == nil {
+		t.Error("unknown metadata type: got nil error, want error")
+	}
+}
+
+func TestPrepareDatabaseForDrop(t *testing.T) {
+	defer fastPoll()()
+	const db = "projects/p/instances/i/databases/d"
+	srv := &opsServer{ops: []*longrunningpb.Operation{
+		newOp(t, db+"/operations/done", true, ddlMeta(t, db)),
+		newOp(t, db+"/operations/ddl1", false, ddlMeta(t, db)),
+		newOp(t, db+"/operations/ddl2", false, ddlMeta(t, db)),
+		newOp(t, db+"2/operations/other", false, ddlMeta(t, db+"2")),
+	}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	if err := c.PrepareDatabaseForDrop(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{db + "/operations/ddl1", db + "/operations/ddl2"}; !reflect.DeepEqual(srv.canceled, want) {
+		t.Errorf("canceled %q, want %q", srv.canceled, want)
+	}
+
+	// A running operation that cannot be cancelled is waited for.
+	srv.ops = append(srv.ops, newOp(t, db+"/operations/create", false, &databasepb.CreateDatabaseMetadata{Database: db}))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.PrepareDatabaseForDrop(ctx, db); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+}
+
+// instanceOpsServer adds ListDatabases to opsServer, listing the databases
+// dbs.
+type instanceOpsServer struct {
+	opsServer
+	dbs []string
+}
+
+func (s *instanceOpsServer) ListDatabases(ctx context.Context, req *databasepb.ListDatabasesRequest) (*databasepb.ListDatabasesResponse, error) {
+	resp := &databasepb.ListDatabasesResponse{}
+	for _, db := range s.dbs {
+		resp.Databases = append(resp.Databases, &databasepb.Database{Name: req.Parent + "/databases/" + db})
+	}
+	return resp, nil
+}
+
+func TestForEachDatabaseOperation(t *testing.T) {
+	const inst = "projects/p/instances/i"
+	srv := &instanceOpsServer{dbs: []string{"a", "b", "c"}}
+	srv.pageSize = 1
+	for _, name := range []string{"a/operations/1", "a/operations/2", "c/operations/3", "other/operations/4"} {
+		srv.ops = append(srv.ops, newOp(t, inst+"/databases/"+name, true, &databasepb.CreateDatabaseMetadata{}))
+	}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	var got []string
+	err := c.ForEachDatabaseOperation(context.Background(), inst, func(op *longrunningpb.Operation) error {
+		got = append(got, op.Name[len(inst+"/databases/"):])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a/operations/1", "a/operations/2", "c/operations/3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	got = nil
+	err = c.ForEachDatabaseOperation(context.Background(), inst, func(op *longrunningpb.Operation) error {
+		got = append(got, op.Name)
+		return ErrStopIteration
+	})
+	if err != nil || len(got) != 1 {
+		t.Errorf("ErrStopIteration: got %d operations and error %v, want 1 and nil", len(got), err)
+	}
+	errFn := errors.New("fn failed")
+	if err := c.ForEachDatabaseOperation(context.Background(), inst, func(*longrunningpb.Operation) error { return errFn }); err != errFn {
+		t.Errorf("got %v, want fn's error", err)
+	}
+}
+
+func TestResumableOperations(t *testing.T) {
+	const inst = "projects/p/instances/i"
+	srv := &instanceOpsServer{dbs: []string{"a", "b"}}
+	srv.ops = []*longrunningpb.Operation{
+		newOp(t, inst+"/databases/a/operations/create", true, &databasepb.CreateDatabaseMetadata{}),
+		newOp(t, inst+"/databases/a/operations/ddl", false, ddlMeta(t, inst+"/databases/a")),
+		newOp(t, inst+"/databases/b/operations/create", false, &databasepb.CreateDatabaseMetadata{}),
+	}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	ops, err := c.ResumableOperations(context.Background(), inst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, op := range ops {
+		got = append(got, op.Type+" "+op.Name[len(inst+"/databases/"):])
+	}
+	if want := []string{"UpdateDatabaseDdl a/operations/ddl", "CreateDatabase b/operations/create"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	srv.mu.Lock()
+	srv.ops[1] = &longrunningpb.Operation{
+		Name:   srv.ops[1].Name,
+		Done:   true,
+		Result: &longrunningpb.Operation_Error{Error: &spb.Status{Code: int32(codes.Aborted), Message: "aborted"}},
+	}
+	srv.mu.Unlock()
+	if err := ops[0].Poll(context.Background()); status.Code(err) != codes.Aborted || !ops[0].Done() {
+		t.Errorf("Poll: got %v and done=%t, want Aborted and done", err, ops[0].Done())
+	}
+	if err := ops[1].Poll(context.Background()); err != nil || ops[1].Done() {
+		t.Errorf("Poll: got %v and done=%t, want nil and not done", err, ops[1].Done())
+	}
+}
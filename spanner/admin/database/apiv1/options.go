@@ -0,0 +1,139 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+)
+
+type annotationsKey struct{}
+
+// AnnotateContext returns a copy of ctx carrying the request annotation
+// key=value, in addition to any annotations already present in ctx. Clients
+// created with WithContextMetadataKeys send the annotations whose keys were
+// listed in that option as gRPC metadata.
+func AnnotateContext(ctx context.Context, key, value string) context.Context {
+	old, _ := ctx.Value(annotationsKey{}).(map[string]string)
+	m := make(map[string]string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[key] = value
+	return context.WithValue(ctx, annotationsKey{}, m)
+}
+
+// WithContextMetadataKeys returns a ClientOption that, on every call, copies the
+// request annotations with the given keys from the call's context (see
+// AnnotateContext) into the outgoing gRPC metadata. Annotations with other
+// keys are not sent. Metadata keys are lower-cased, as gRPC requires.
+//
+// The option has no effect for clients created with option.WithGRPCConn,
+// including a ReplayClient.
+func WithContextMetadataKeys(keys []string) option.ClientOption {
+	keys = append([]string(nil), keys...)
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if m, ok := ctx.Value(annotationsKey{}).(map[string]string); ok {
+				for _, k := range keys {
+					if v, ok := m[k]; ok {
+						ctx = metadata.AppendToOutgoingContext(ctx, strings.ToLower(k), v)
+					}
+				}
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}))
+}
+
+// WithMethodTimeouts returns a ClientOption that gives calls of the listed
+// methods a timeout when their context has no deadline. Calls whose context
+// already has a deadline, and calls of unlisted methods, are unaffected.
+//
+// The keys are RPC method names without the service name: the names of the
+// client's methods, such as "GetDatabase", "UpdateDatabaseDdl" or
+// "ListDatabases", and, for calls made through LROClient, the Operations
+// service's "GetOperation", "ListOperations", "CancelOperation" and
+// "DeleteOperation". Keys that name no method are ignored.
+//
+// The timeout applies to each attempt of a call, so a call that is retried
+// may take longer in total. Waiting for a long-running operation issues a
+// separate GetOperation call for each poll.
+//
+// The option has no effect for clients created with option.WithGRPCConn,
+// including a ReplayClient.
+func WithMethodTimeouts(timeouts map[string]time.Duration) option.ClientOption {
+	m := make(map[string]time.Duration, len(timeouts))
+	for k, d := range timeouts {
+		m[k] = d
+	}
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if _, ok := ctx.Deadline(); !ok {
+				if d, ok := m[method[strings.LastIndex(method, "/")+1:]]; ok {
+					var cancel context.CancelFunc
+					ctx, cancel = context.WithTimeout(ctx, d)
+					defer cancel()
+				}
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}))
+}
+
+// WithGRPCCompression returns a ClientOption that, if enabled is true,
+// compresses the requests of every call with gzip. Compression is worth
+// enabling for large requests, such as long lists of DDL statements, on
+// constrained networks. Responses are compressed at the server's discretion.
+//
+// The option has no effect for clients created with option.WithGRPCConn,
+// including a ReplayClient.
+func WithGRPCCompression(enabled bool) option.ClientOption {
+	if !enabled {
+		return option.WithGRPCDialOption(grpc.EmptyDialOption{})
+	}
+	return option.WithGRPCDialOption(grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)))
+}
+
+// WithDatabaseNameValidator returns a ClientOption that checks the ID of
+// every database the client creates with validate before the request is
+// sent. This applies to CreateDatabase and to every helper in this package
+// that creates a database. If validate returns an error, the database is not
+// created and the call returns that error.
+//
+// The ID is taken from the request's CREATE DATABASE statement, without
+// backticks. Requests whose statement cannot be read are sent unchecked, for
+// the service to reject.
+//
+// The option has no effect for clients created with option.WithGRPCConn,
+// including a ReplayClient.
+func WithDatabaseNameValidator(validate func(id string) error) option.ClientOption {
+	return option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if r, ok := req.(*databasepb.CreateDatabaseRequest); ok {
+				if id, ok := createDatabaseID(r.CreateStatement); ok {
+					if err := validate(id); err != nil {
+						return err
+					}
+				}
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}))
+}
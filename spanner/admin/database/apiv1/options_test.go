@@ -0,0 +1,211 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"google.golang.org/api/option"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+// mdServer records the incoming metadata of GetDatabase calls.
+type mdServer struct {
+	mockDatabaseAdminServer
+	md metadata.MD
+}
+
+func (s *mdServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	return &databasepb.Database{Name: req.Name}, nil
+}
+
+func TestWithContextMetadataKeys(t *testing.T) {
+	srv := &mdServer{}
+	c, stop := newServerClient(t, srv, WithContextMetadataKeys([]string{"X-Tenant-ID", "baggage"}))
+	defer stop()
+	defer c.Close()
+
+	ctx := AnnotateContext(context.Background(), "X-Tenant-ID", "tenant-1")
+	ctx = AnnotateContext(ctx, "unlisted", "secret")
+	if _, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: "db"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := srv.md["x-tenant-id"], []string{"tenant-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("x-tenant-id = %q, want %q", got, want)
+	}
+	for _, k := range []string{"baggage", "unlisted"} {
+		if got, ok := srv.md[k]; ok {
+			t.Errorf("%s = %q, want no such header", k, got)
+		}
+	}
+}
+
+// deadlineServer records, for each method called, how long the incoming
+// context had until its deadline, or -1 if it had no deadline.
+type deadlineServer struct {
+	mockDatabaseAdminServer
+
+	mu        sync.Mutex
+	remaining map[string]time.Duration
+}
+
+func (s *deadlineServer) record(ctx context.Context, method string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := time.Duration(-1)
+	if dl, ok := ctx.Deadline(); ok {
+		d = time.Until(dl)
+	}
+	s.remaining[method] = d
+}
+
+func (s *deadlineServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	s.record(ctx, "GetDatabase")
+	return &databasepb.Database{Name: req.Name}, nil
+}
+
+func (s *deadlineServer) GetDatabaseDdl(ctx context.Context, req *databasepb.GetDatabaseDdlRequest) (*databasepb.GetDatabaseDdlResponse, error) {
+	s.record(ctx, "GetDatabaseDdl")
+	return &databasepb.GetDatabaseDdlResponse{}, nil
+}
+
+func TestWithMethodTimeouts(t *testing.T) {
+	srv := &deadlineServer{remaining: map[string]time.Duration{}}
+	c, stop := newServerClient(t, srv, WithMethodTimeouts(map[string]time.Duration{
+		"GetDatabase": 10 * time.Second,
+		"NoSuchRPC":   time.Second,
+	}))
+	defer stop()
+	defer c.Close()
+
+	ctx := context.Background()
+	if _, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: "db"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: "db"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := srv.remaining["GetDatabase"]; d <= 0 || d > 10*time.Second {
+		t.Errorf("GetDatabase: deadline in %v, want in at most 10s", d)
+	}
+	if d := srv.remaining["GetDatabaseDdl"]; d != -1 {
+		t.Errorf("GetDatabaseDdl: deadline in %v, want no deadline", d)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Hour)
+	defer cancel()
+	if _, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: "db"}); err != nil {
+		t.Fatal(err)
+	}
+	if d := srv.remaining["GetDatabase"]; d <= 10*time.Second {
+		t.Errorf("GetDatabase with caller deadline: deadline in %v, want the caller's hour", d)
+	}
+}
+
+// payloadStats records the sizes of the payloads a client sends.
+type payloadStats struct {
+	mu                 sync.Mutex
+	length, wireLength int
+}
+
+func (s *payloadStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (s *payloadStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+func (s *payloadStats) HandleConn(context.Context, stats.ConnStats)                       {}
+
+func (s *payloadStats) HandleRPC(ctx context.Context, rs stats.RPCStats) {
+	if p, ok := rs.(*stats.OutPayload); ok {
+		s.mu.Lock()
+		s.length += p.Length
+		s.wireLength += p.WireLength
+		s.mu.Unlock()
+	}
+}
+
+func TestWithGRPCCompression(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		ps := &payloadStats{}
+		c, stop := newServerClient(t, &ddlServer{}, WithGRPCCompression(enabled), option.WithGRPCDialOption(grpc.WithStatsHandler(ps)))
+		stmt := "CREATE TABLE A (" + strings.Repeat("x INT64, ", 10000) + ") PRIMARY KEY (x)"
+		err := c.ApplyDDL(context.Background(), "db", []string{stmt})
+		c.Close()
+		stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed := ps.wireLength < ps.length/2; compressed != enabled {
+			t.Errorf("enabled=%t: sent %d bytes on the wire for %d bytes of requests", enabled, ps.wireLength, ps.length)
+		}
+	}
+}
+
+// createServer completes every CreateDatabase call at once, recording the
+// statements.
+type createServer struct {
+	mockDatabaseAdminServer
+
+	mu      sync.Mutex
+	created []string
+}
+
+func (s *createServer) CreateDatabase(ctx context.Context, req *databasepb.CreateDatabaseRequest) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = append(s.created, req.CreateStatement)
+	any, err := ptypes.MarshalAny(&databasepb.Database{Name: req.Parent + "/databases/new", State: databasepb.Database_READY})
+	if err != nil {
+		return nil, err
+	}
+	return &longrunningpb.Operation{Name: "create", Done: true, Result: &longrunningpb.Operation_Response{Response: any}}, nil
+}
+
+func TestWithDatabaseNameValidator(t *testing.T) {
+	errPrefix := errors.New("database IDs must start with prod-")
+	srv := &createServer{}
+	c, stop := newServerClient(t, srv, WithDatabaseNameValidator(func(id string) error {
+		if !strings.HasPrefix(id, "prod-") {
+			return errPrefix
+		}
+		return nil
+	}))
+	defer stop()
+	defer c.Close()
+
+	ctx := context.Background()
+	const parent = "projects/p/instances/i"
+	if _, err := c.ImportSchema(ctx, parent, "prod-orders", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{Parent: parent, CreateStatement: "CREATE DATABASE orders"}); err != errPrefix {
+		t.Errorf("CreateDatabase: got %v, want the validator's error", err)
+	}
+	if _, err := c.ImportSchema(ctx, parent, "dev-orders", ""); err != errPrefix {
+		t.Errorf("ImportSchema: got %v, want the validator's error", err)
+	}
+	if want := []string{"CREATE DATABASE `prod-orders`"}; !reflect.DeepEqual(srv.created, want) {
+		t.Errorf("created %q, want %q", srv.created, want)
+	}
+}
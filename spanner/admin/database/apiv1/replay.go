@@ -0,0 +1,105 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/rpcreplay"
+	"google.golang.org/api/option"
+)
+
+// RecordingClient is a DatabaseAdminClient that records the requests it makes
+// and the responses it receives to a file, for replay with a ReplayClient.
+// Calls made through its LROClient, including those made while waiting for
+// an operation, are recorded too.
+type RecordingClient struct {
+	*DatabaseAdminClient
+	rec *rpcreplay.Recorder
+
+	closeOnce sync.Once
+}
+
+// NewRecordingClient creates a client that connects to the service as
+// NewDatabaseAdminClient does and records its calls to the file filename,
+// which is created or truncated. The recording is complete once the client
+// has been closed.
+func NewRecordingClient(ctx context.Context, filename string, opts ...option.ClientOption) (*RecordingClient, error) {
+	rec, err := rpcreplay.NewRecorder(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range rec.DialOptions() {
+		opts = append(opts, option.WithGRPCDialOption(o))
+	}
+	c, err := NewDatabaseAdminClient(ctx, opts...)
+	if err != nil {
+		rec.Close()
+		return nil, err
+	}
+	return &RecordingClient{DatabaseAdminClient: c, rec: rec}, nil
+}
+
+// Close closes the connection to the service and finishes writing the
+// recording. Calls after the first have no effect and return nil.
+func (c *RecordingClient) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.DatabaseAdminClient.Close()
+		if err2 := c.rec.Close(); err == nil {
+			err = err2
+		}
+	})
+	return err
+}
+
+// ReplayClient is a DatabaseAdminClient that serves the responses recorded by
+// a RecordingClient without connecting to the service. Its calls must be the
+// ones that were recorded, with equal requests; a call that was not recorded
+// fails.
+type ReplayClient struct {
+	*DatabaseAdminClient
+	rep *rpcreplay.Replayer
+}
+
+// NewReplayClient creates a client that replays the recording in the file
+// filename. Options that set up the connection, including the ones in this
+// package, have no effect on a ReplayClient.
+func NewReplayClient(ctx context.Context, filename string, opts ...option.ClientOption) (*ReplayClient, error) {
+	rep, err := rpcreplay.NewReplayer(filename)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := rep.Connection()
+	if err != nil {
+		rep.Close()
+		return nil, err
+	}
+	c, err := NewDatabaseAdminClient(ctx, append(opts, option.WithGRPCConn(conn))...)
+	if err != nil {
+		rep.Close()
+		return nil, err
+	}
+	return &ReplayClient{DatabaseAdminClient: c, rep: rep}, nil
+}
+
+// Close closes the client.
+func (c *ReplayClient) Close() error {
+	// The replay connection is never connected to a server and was closed by
+	// rep.Connection, so closing it again only reports that.
+	c.DatabaseAdminClient.Close()
+	return c.rep.Close()
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "database-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "admin.replay")
+	ctx := context.Background()
+	stmts := []string{"DROP INDEX SingerByName"}
+
+	srv := &ddlServer{statements: singerStatements[:2]}
+	addr, stop := startServer(t, srv)
+	rc, err := NewRecordingClient(ctx, filename, serverOptions(addr)...)
+	if err != nil {
+		stop()
+		t.Fatal(err)
+	}
+	recorded, err := rc.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.ApplyDDL(ctx, "db", stmts); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rc.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	stop()
+
+	pc, err := NewReplayClient(ctx, filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	replayed, err := pc.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: "db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(replayed, recorded) {
+		t.Errorf("replayed %v, want %v", replayed, recorded)
+	}
+	if err := pc.ApplyDDL(ctx, "db", stmts); err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.ApplyDDL(ctx, "db", []string{"DROP TABLE Singers"}); err == nil {
+		t.Error("unrecorded call: got nil error, want error")
+	}
+	if want := [][]string{stmts}; !reflect.DeepEqual(srv.updates, want) {
+		t.Errorf("server got updates %q, want %q", srv.updates, want)
+	}
+}
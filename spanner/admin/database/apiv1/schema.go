@@ -0,0 +1,398 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/internal/trace"
+	gax "github.com/googleapis/gax-go/v2"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxDDLStatementsPerRequest is the largest number of statements ApplyDDL
+// sends in a single schema update. It mirrors the limit enforced by Cloud
+// Spanner, so that oversized batches are rejected before they reach the
+// service; callers submitting more statements should split them into batches
+// of at most this size.
+var MaxDDLStatementsPerRequest = 10000
+
+// ApplyDDL applies the DDL statements to the database databaseName in a single
+// schema update and waits for the update to finish.
+//
+// If the request is rejected as larger than a gRPC message size limit, the
+// returned error keeps the ResourceExhausted code and says how to make the
+// request fit.
+func (c *DatabaseAdminClient) ApplyDDL(ctx context.Context, databaseName string, statements []string, opts ...gax.CallOption) error {
+	if err := checkDDLBatch(statements); err != nil {
+		return err
+	}
+	op, err := c.UpdateDatabaseDdl(ctx, &databasepb.UpdateDatabaseDdlRequest{
+		Database:   databaseName,
+		Statements: statements,
+	}, opts...)
+	if err != nil {
+		return ddlSizeError(err)
+	}
+	ctx = startWaitSpan(ctx, "ApplyDDL")
+	err = op.Wait(ctx, opts...)
+	trace.EndSpan(ctx, err)
+	return err
+}
+
+// checkDDLBatch returns an error if statements cannot be applied in a single
+// schema update.
+func checkDDLBatch(statements []string) error {
+	if len(statements) == 0 {
+		return errors.New("database: no DDL statements to apply")
+	}
+	if n := len(statements); n > MaxDDLStatementsPerRequest {
+		return fmt.Errorf("database: %d DDL statements exceed the limit of %d per schema update; apply them in batches of at most MaxDDLStatementsPerRequest", n, MaxDDLStatementsPerRequest)
+	}
+	return nil
+}
+
+// ddlSizeError adds guidance to err if it reports that a schema update
+// request exceeded a gRPC message size limit, and returns other errors
+// unchanged. gRPC reports both the client's send limit and the server's
+// receive limit as ResourceExhausted errors whose message says the message is
+// "larger than max"; other ResourceExhausted errors, such as quota errors,
+// are left alone.
+func ddlSizeError(err error) error {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.ResourceExhausted || !strings.Contains(s.Message(), "larger than max") {
+		return err
+	}
+	if strings.Contains(s.Message(), "trying to send") {
+		return status.Errorf(codes.ResourceExhausted, "database: schema update request too large: %s; split the statements into smaller batches, or raise the client's limit with option.WithGRPCDialOption(grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(n)))", s.Message())
+	}
+	return status.Errorf(codes.ResourceExhausted, "database: schema update request too large for the service: %s; split the statements into smaller batches", s.Message())
+}
+
+// AddColumn adds a column to table in the database databaseName and waits for
+// the schema change to complete. columnDef is the column definition as it
+// appears in a CREATE TABLE statement, for example "Notes STRING(MAX)".
+func (c *DatabaseAdminClient) AddColumn(ctx context.Context, databaseName, table, columnDef string, opts ...gax.CallOption) error {
+	quoted, err := QuoteIdentifier(table)
+	if err != nil {
+		return err
+	}
+	toks := ddlTokens(columnDef)
+	if len(toks) < 2 {
+		return fmt.Errorf("database: column definition %q needs a name and a type", columnDef)
+	}
+	if err := validateIdentifier(toks[0].text); err != nil {
+		return err
+	}
+	stmt := "ALTER TABLE " + quoted + " ADD COLUMN " + strings.TrimSpace(columnDef)
+	return c.ApplyDDL(ctx, databaseName, []string{stmt}, opts...)
+}
+
+// DropAllTables drops every table and index of the database databaseName,
+// leaving the database itself in place with an empty schema. It is intended
+// for resetting test and development databases.
+//
+// The drop statements are ordered on a best-effort basis, using only the
+// statements returned by GetDatabaseDdl: foreign keys added by ALTER TABLE
+// statements are dropped first, then all indexes, and then the tables in the
+// reverse of the order they were created in, so that interleaved and
+// referencing tables are dropped before the tables they depend on.
+func (c *DatabaseAdminClient) DropAllTables(ctx context.Context, databaseName string, opts ...gax.CallOption) error {
+	resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+	if err != nil {
+		return err
+	}
+	var objs []ddlObject
+	for _, stmt := range resp.Statements {
+		if o, ok := createdObject(stmt); ok {
+			objs = append(objs, o)
+		}
+	}
+	if len(objs) == 0 {
+		return nil
+	}
+	return c.ApplyDDL(ctx, databaseName, dropOrder(objs), opts...)
+}
+
+// DropObject drops the table or index objectName from the database
+// databaseName, in a single schema update. Dropping a table also drops the
+// indexes on it and the foreign keys that were added to it, or that refer to
+// it, by ALTER TABLE statements. Names are compared ignoring case.
+//
+// Interleaved child tables and foreign keys declared inside another table's
+// CREATE TABLE statement are not dropped; if any refer to the table, the
+// schema update fails.
+func (c *DatabaseAdminClient) DropObject(ctx context.Context, databaseName, objectName string, opts ...gax.CallOption) error {
+	resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+	if err != nil {
+		return err
+	}
+	var objs []ddlObject
+	for _, stmt := range resp.Statements {
+		if o, ok := createdObject(stmt); ok && o.kind != "CONSTRAINT" && strings.EqualFold(o.name, objectName) {
+			objs = append(objs, o)
+			break
+		}
+	}
+	if len(objs) == 0 {
+		return fmt.Errorf("database: no table or index named %q in %s", objectName, databaseName)
+	}
+	if objs[0].kind == "TABLE" {
+		table := objs[0].name
+		objs = objs[:0]
+		for _, stmt := range resp.Statements {
+			o, ok := createdObject(stmt)
+			if ok && (o.kind == "TABLE" && strings.EqualFold(o.name, table) ||
+				o.kind != "TABLE" && strings.EqualFold(o.table, table) ||
+				o.kind == "CONSTRAINT" && strings.EqualFold(o.references, table)) {
+				objs = append(objs, o)
+			}
+		}
+	}
+	return c.ApplyDDL(ctx, databaseName, dropOrder(objs), opts...)
+}
+
+// DatabaseDescription summarises a database, as returned by
+// DescribeDatabase.
+type DatabaseDescription struct {
+	Name  string
+	State databasepb.Database_State
+
+	// StatementCount is the number of statements in the database's schema,
+	// as returned by GetDatabaseDdl.
+	StatementCount int
+
+	// Tables and Indexes are the names of the tables and indexes in the
+	// schema, in the order they were created.
+	Tables, Indexes []string
+}
+
+// DescribeDatabase returns a summary of the database databaseName, made from
+// one GetDatabase and one GetDatabaseDdl call.
+//
+// This version of the API reports only a database's name and state, so
+// facts such as its creation time, default leader or encryption are not
+// part of the summary.
+func (c *DatabaseAdminClient) DescribeDatabase(ctx context.Context, databaseName string, opts ...gax.CallOption) (*DatabaseDescription, error) {
+	db, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: databaseName}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	d := &DatabaseDescription{
+		Name:           db.Name,
+		State:          db.State,
+		StatementCount: len(resp.Statements),
+	}
+	for _, stmt := range resp.Statements {
+		o, ok := createdObject(stmt)
+		switch {
+		case ok && o.kind == "TABLE":
+			d.Tables = append(d.Tables, o.name)
+		case ok && o.kind == "INDEX":
+			d.Indexes = append(d.Indexes, o.name)
+		}
+	}
+	return d, nil
+}
+
+// SchemaDriftReport compares the schema of the database databaseName with
+// the statements in expectedStatements. It returns the live statements that
+// are not expected (added) and the expected statements that are not live
+// (missing), each in their original order and form. Statements are compared
+// after normalising whitespace and removing trailing semicolons, the comma
+// the service writes after the last column of a table and backticks around
+// identifiers; a statement that appears twice on one side only matches
+// twice on the other.
+func (c *DatabaseAdminClient) SchemaDriftReport(ctx context.Context, databaseName string, expectedStatements []string, opts ...gax.CallOption) (added, missing []string, err error) {
+	resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	unmatched := make(map[string]int)
+	for _, stmt := range expectedStatements {
+		unmatched[normalizeDDL(stmt, false)]++
+	}
+	for _, stmt := range resp.Statements {
+		n := normalizeDDL(stmt, false)
+		if unmatched[n] > 0 {
+			unmatched[n]--
+		} else {
+			added = append(added, stmt)
+		}
+	}
+	for _, stmt := range expectedStatements {
+		n := normalizeDDL(stmt, false)
+		if unmatched[n] > 0 {
+			unmatched[n]--
+			missing = append(missing, stmt)
+		}
+	}
+	return added, missing, nil
+}
+
+// ReconcileIndexes creates those of the desired indexes that the database
+// databaseName does not have, in a single schema change, and waits for them
+// to be built. Indexes are matched by name, ignoring case, so an existing
+// index is left as it is even if its definition differs from the desired
+// one. Indexes that are not desired are left in place.
+func (c *DatabaseAdminClient) ReconcileIndexes(ctx context.Context, databaseName string, desired []IndexSpec, opts ...gax.CallOption) error {
+	resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+	if err != nil {
+		return err
+	}
+	schema, err := ParseDDLSchema(resp.Statements)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]bool)
+	for _, ix := range schema.Indexes {
+		existing[strings.ToLower(ix.Name)] = true
+	}
+	var stmts []string
+	for _, ix := range desired {
+		if existing[strings.ToLower(ix.Name)] {
+			continue
+		}
+		stmt, err := ix.createStatement()
+		if err != nil {
+			return err
+		}
+		existing[strings.ToLower(ix.Name)] = true
+		stmts = append(stmts, stmt)
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+	return c.ApplyDDL(ctx, databaseName, stmts, opts...)
+}
+
+// ImportSchema creates the database databaseID in the instance parent and
+// applies the schema in script.
+//
+// script holds DDL statements separated by semicolons, for example the
+// statements returned by GetDatabaseDdl joined with ";\n". Semicolons inside
+// quoted strings, quoted identifiers and comments do not end a statement. If
+// the first statement is a CREATE DATABASE statement it is replaced by one for
+// databaseID, so a script exported from another database can be imported
+// under a new name.
+//
+// ImportSchema returns an error without calling the service if databaseID is
+// not a valid database ID. It blocks until the database has been created.
+func (c *DatabaseAdminClient) ImportSchema(ctx context.Context, parent, databaseID, script string, opts ...gax.CallOption) (*databasepb.Database, error) {
+	if err := validateDatabaseID(databaseID); err != nil {
+		return nil, err
+	}
+	stmts, err := splitStatements(script)
+	if err != nil {
+		return nil, fmt.Errorf("database: parsing schema script: %v", err)
+	}
+	if len(stmts) > 0 {
+		if _, ok := createDatabaseID(stmts[0]); ok {
+			stmts = stmts[1:]
+		}
+	}
+	op, err := c.CreateDatabase(ctx, &databasepb.CreateDatabaseRequest{
+		Parent:          parent,
+		CreateStatement: "CREATE DATABASE " + quoteIdent(databaseID),
+		ExtraStatements: stmts,
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	ctx = startWaitSpan(ctx, "ImportSchema")
+	db, err := op.Wait(ctx, opts...)
+	trace.EndSpan(ctx, err)
+	return db, err
+}
+
+// splitStatements splits script into individual statements at each semicolon
+// that is not part of a quoted string, a quoted identifier or a comment.
+// Comments are removed, surrounding whitespace is trimmed, and empty
+// statements are dropped.
+func splitStatements(script string) ([]string, error) {
+	var (
+		stmts []string
+		cur   strings.Builder
+	)
+	flush := func() {
+		if s := strings.TrimSpace(cur.String()); s != "" {
+			stmts = append(stmts, s)
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(script); {
+		switch ch := script[i]; {
+		case ch == ';':
+			flush()
+			i++
+		case ch == '#' || strings.HasPrefix(script[i:], "--"):
+			n := strings.IndexByte(script[i:], '\n')
+			if n < 0 {
+				n = len(script) - i
+			}
+			cur.WriteByte(' ')
+			i += n
+		case strings.HasPrefix(script[i:], "/*"):
+			n := strings.Index(script[i+2:], "*/")
+			if n < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			cur.WriteByte(' ')
+			i += n + 4
+		case ch == '\'' || ch == '"' || ch == '`':
+			n, err := quotedLen(script[i:])
+			if err != nil {
+				return nil, err
+			}
+			cur.WriteString(script[i : i+n])
+			i += n
+		default:
+			cur.WriteByte(ch)
+			i++
+		}
+	}
+	flush()
+	return stmts, nil
+}
+
+// quotedLen returns the length of the quoted string or identifier at the
+// start of s, including its delimiters. Both single and triple quoting are
+// recognised, and a backslash escapes the following character.
+func quotedLen(s string) (int, error) {
+	delim := s[:1]
+	if delim != "`" && len(s) >= 3 && s[1] == s[0] && s[2] == s[0] {
+		delim = s[:3]
+	}
+	for i := len(delim); i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case strings.HasPrefix(s[i:], delim):
+			return i + len(delim), nil
+		case len(delim) == 1 && s[i] == '\n':
+			return 0, fmt.Errorf("newline in quoted string %s", s[:i])
+		}
+	}
+	return 0, fmt.Errorf("unterminated quoted string %.20s", s)
+}
@@ -0,0 +1,484 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
+	"google.golang.org/api/option"
+	longrunningpb "google.golang.org/genproto/googleapis/longrunning"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSplitStatements(t *testing.T) {
+	for _, test := range []struct {
+		script string
+		want   []string
+	}{
+		{"", nil},
+		{"  ;\n; ", nil},
+		{
+			"CREATE TABLE A (x INT64) PRIMARY KEY (x);\nCREATE INDEX AByX ON A(x)",
+			[]string{"CREATE TABLE A (x INT64) PRIMARY KEY (x)", "CREATE INDEX AByX ON A(x)"},
+		},
+		{
+			"CREATE TABLE `semi;colon` (x STRING(MAX) DEFAULT ('a;b')) PRIMARY KEY (x);",
+			[]string{"CREATE TABLE `semi;colon` (x STRING(MAX) DEFAULT ('a;b')) PRIMARY KEY (x)"},
+		},
+		{
+			"CREATE TABLE A (x INT64) -- trailing; comment\nPRIMARY KEY (x); /* block; */ DROP TABLE B # done;",
+			[]string{"CREATE TABLE A (x INT64)  \nPRIMARY KEY (x)", "DROP TABLE B"},
+		},
+		{
+			`SELECT """multi;` + "\n" + `line""", 'it\'s;'`,
+			[]string{`SELECT """multi;` + "\n" + `line""", 'it\'s;'`},
+		},
+	} {
+		got, err := splitStatements(test.script)
+		if err != nil {
+			t.Errorf("splitStatements(%q): %v", test.script, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitStatements(%q) = %q, want %q", test.script, got, test.want)
+		}
+	}
+}
+
+func TestSplitStatementsErrors(t *testing.T) {
+	for _, script := range []string{
+		"CREATE TABLE `A (x INT64)",
+		"SELECT 'a\nb'",
+		"DROP TABLE A /* no end",
+	} {
+		if _, err := splitStatements(script); err == nil {
+			t.Errorf("splitStatements(%q): got nil error, want error", script)
+		}
+	}
+}
+
+func TestImportSchema(t *testing.T) {
+	expectedResponse := &databasepb.Database{Name: "projects/p/instances/i/databases/copy"}
+	mockDatabaseAdmin.err = nil
+	mockDatabaseAdmin.reqs = nil
+	mockDatabaseAdmin.resps = append(mockDatabaseAdmin.resps[:0], doneOp(t, expectedResponse))
+
+	c, err := NewDatabaseAdminClient(context.Background(), clientOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := "create database`orig`;\nCREATE TABLE A (x INT64) PRIMARY KEY (x);\nCREATE INDEX AByX ON A(x);\n"
+	resp, err := c.ImportSchema(context.Background(), "projects/p/instances/i", "copy", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantReq := &databasepb.CreateDatabaseRequest{
+		Parent:          "projects/p/instances/i",
+		CreateStatement: "CREATE DATABASE `copy`",
+		ExtraStatements: []string{"CREATE TABLE A (x INT64) PRIMARY KEY (x)", "CREATE INDEX AByX ON A(x)"},
+	}
+	if got := mockDatabaseAdmin.reqs[0]; !proto.Equal(got, wantReq) {
+		t.Errorf("wrong request %q, want %q", got, wantReq)
+	}
+	if !proto.Equal(resp, expectedResponse) {
+		t.Errorf("wrong response %q, want %q", resp, expectedResponse)
+	}
+}
+
+func TestImportSchemaInvalidID(t *testing.T) {
+	mockDatabaseAdmin.err = nil
+	mockDatabaseAdmin.reqs = nil
+
+	c, err := NewDatabaseAdminClient(context.Background(), clientOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"", "Copy", "1copy", "copy_", "has space"} {
+		if _, err := c.ImportSchema(context.Background(), "projects/p/instances/i", id, "CREATE TABLE A (x INT64) PRIMARY KEY (x)"); err == nil {
+			t.Errorf("ImportSchema(%q): got nil error", id)
+		}
+	}
+	if n := len(mockDatabaseAdmin.reqs); n != 0 {
+		t.Errorf("got %d requests, want 0", n)
+	}
+}
+
+func TestApplyDDL(t *testing.T) {
+	mockDatabaseAdmin.err = nil
+	mockDatabaseAdmin.reqs = nil
+	mockDatabaseAdmin.resps = append(mockDatabaseAdmin.resps[:0], doneOp(t, &emptypb.Empty{}))
+
+	c, err := NewDatabaseAdminClient(context.Background(), clientOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts := []string{"CREATE TABLE A (x INT64) PRIMARY KEY (x)"}
+	if err := c.ApplyDDL(context.Background(), "db", stmts); err != nil {
+		t.Fatal(err)
+	}
+	want := &databasepb.UpdateDatabaseDdlRequest{Database: "db", Statements: stmts}
+	if got := mockDatabaseAdmin.reqs[0]; !proto.Equal(got, want) {
+		t.Errorf("wrong request %q, want %q", got, want)
+	}
+}
+
+func TestApplyDDLTooManyStatements(t *testing.T) {
+	defer func(n int) { MaxDDLStatementsPerRequest = n }(MaxDDLStatementsPerRequest)
+	MaxDDLStatementsPerRequest = 2
+	mockDatabaseAdmin.reqs = nil
+
+	c, err := NewDatabaseAdminClient(context.Background(), clientOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmts := range [][]string{nil, {"DROP TABLE A", "DROP TABLE B", "DROP TABLE C"}} {
+		if err := c.ApplyDDL(context.Background(), "db", stmts); err == nil {
+			t.Errorf("ApplyDDL with %d statements: got nil error, want error", len(stmts))
+		}
+	}
+	if len(mockDatabaseAdmin.reqs) != 0 {
+		t.Errorf("got %d requests, want none", len(mockDatabaseAdmin.reqs))
+	}
+}
+
+func TestApplyDDLMessageTooLarge(t *testing.T) {
+	stmt := "CREATE TABLE A (" + strings.Repeat("x INT64, ", 1000) + ") PRIMARY KEY (x)"
+
+	// The client's send limit.
+	c, stop := newServerClient(t, &ddlServer{}, option.WithGRPCDialOption(grpc.WithDefaultCallOptions(grpc.MaxCallSendMsgSize(1024))))
+	err := c.ApplyDDL(context.Background(), "db", []string{stmt})
+	c.Close()
+	stop()
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Errorf("client limit: got code %v (%v), want ResourceExhausted", got, err)
+	}
+	if msg := status.Convert(err).Message(); !strings.Contains(msg, "smaller batches") || !strings.Contains(msg, "MaxCallSendMsgSize") {
+		t.Errorf("client limit: got message %q, want guidance", msg)
+	}
+
+	// The server's receive limit.
+	serv := grpc.NewServer(grpc.MaxRecvMsgSize(1024))
+	databasepb.RegisterDatabaseAdminServer(serv, &ddlServer{})
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serv.Serve(lis)
+	defer serv.Stop()
+	c, err = NewDatabaseAdminClient(context.Background(), serverOptions(lis.Addr().String())...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	err = c.ApplyDDL(context.Background(), "db", []string{stmt})
+	if got := status.Code(err); got != codes.ResourceExhausted {
+		t.Errorf("server limit: got code %v (%v), want ResourceExhausted", got, err)
+	}
+	if msg := status.Convert(err).Message(); !strings.Contains(msg, "smaller batches") || strings.Contains(msg, "MaxCallSendMsgSize") {
+		t.Errorf("server limit: got message %q, want guidance to split the batch", msg)
+	}
+}
+
+func TestApplyDDLQuotaExhausted(t *testing.T) {
+	quotaErr := status.Error(codes.ResourceExhausted, "quota exceeded")
+	mockDatabaseAdmin.err = quotaErr
+	defer func() { mockDatabaseAdmin.err = nil }()
+
+	c, err := NewDatabaseAdminClient(context.Background(), clientOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ApplyDDL(context.Background(), "db", []string{"DROP TABLE A"})
+	if msg := status.Convert(err).Message(); msg != "quota exceeded" {
+		t.Errorf("got message %q, want the service's message unchanged", msg)
+	}
+}
+
+// ddlServer serves a fixed schema from GetDatabaseDdl and records the
+// statements of each UpdateDatabaseDdl request, completing it immediately.
+type ddlServer struct {
+	mockDatabaseAdminServer
+
+	mu         sync.Mutex
+	statements []string
+	updates    [][]string
+}
+
+func (s *ddlServer) GetDatabaseDdl(ctx context.Context, req *databasepb.GetDatabaseDdlRequest) (*databasepb.GetDatabaseDdlResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &databasepb.GetDatabaseDdlResponse{Statements: s.statements}, nil
+}
+
+func (s *ddlServer) UpdateDatabaseDdl(ctx context.Context, req *databasepb.UpdateDatabaseDdlRequest) (*longrunningpb.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.updates = append(s.updates, req.Statements)
+	any, err := ptypes.MarshalAny(&emptypb.Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return &longrunningpb.Operation{
+		Name:   req.Database + "/operations/op" + strconv.Itoa(len(s.updates)),
+		Done:   true,
+		Result: &longrunningpb.Operation_Response{Response: any},
+	}, nil
+}
+
+var singerStatements = []string{
+	"CREATE TABLE Singers (\n  SingerId INT64 NOT NULL,\n  FirstName STRING(1024),\n) PRIMARY KEY(SingerId)",
+	"CREATE INDEX SingerByName ON Singers(FirstName)",
+	"CREATE TABLE `Order` (\n  OrderId INT64 NOT NULL,\n  SingerId INT64,\n  UpdatedAt TIMESTAMP OPTIONS (allow_commit_timestamp=true),\n  CONSTRAINT FK_Singer FOREIGN KEY (SingerId) REFERENCES Singers (SingerId),\n) PRIMARY KEY(OrderId)",
+	"CREATE TABLE Albums (\n  SingerId INT64 NOT NULL,\n  AlbumId INT64 NOT NULL,\n) PRIMARY KEY(SingerId, AlbumId),\n  INTERLEAVE IN PARENT Singers ON DELETE CASCADE",
+	"CREATE UNIQUE NULL_FILTERED INDEX AlbumsByAlbumId ON Albums(AlbumId) STORING (SingerId), INTERLEAVE IN Singers",
+	"ALTER TABLE Singers ADD CONSTRAINT FK_Album FOREIGN KEY (SingerId) REFERENCES Albums (SingerId)",
+}
+
+func TestDropAllTables(t *testing.T) {
+	srv := &ddlServer{statements: singerStatements}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	if err := c.DropAllTables(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{
+		"ALTER TABLE `Singers` DROP CONSTRAINT `FK_Album`",
+		"DROP INDEX `AlbumsByAlbumId`",
+		"DROP INDEX `SingerByName`",
+		"DROP TABLE `Albums`",
+		"DROP TABLE `Order`",
+		"DROP TABLE `Singers`",
+	}}
+	if !reflect.DeepEqual(srv.updates, want) {
+		t.Errorf("got updates\n%q\nwant\n%q", srv.updates, want)
+	}
+
+	srv.statements, srv.updates = nil, nil
+	if err := c.DropAllTables(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.updates) != 0 {
+		t.Errorf("got updates %q for an empty schema, want none", srv.updates)
+	}
+}
+
+func TestAddColumn(t *testing.T) {
+	srv := &ddlServer{}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	if err := c.AddColumn(context.Background(), "db", "Singers", " Notes STRING(MAX) "); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"ALTER TABLE `Singers` ADD COLUMN Notes STRING(MAX)"}}
+	if !reflect.DeepEqual(srv.updates, want) {
+		t.Errorf("got updates %q, want %q", srv.updates, want)
+	}
+
+	for _, test := range []struct{ table, columnDef string }{
+		{"", "Notes STRING(MAX)"},
+		{"Singers; DROP TABLE Singers", "Notes STRING(MAX)"},
+		{"1Singers", "Notes STRING(MAX)"},
+		{"Singers", ""},
+		{"Singers", "Notes"},
+		{"Singers", "_Notes STRING(MAX)"},
+	} {
+		if err := c.AddColumn(context.Background(), "db", test.table, test.columnDef); err == nil {
+			t.Errorf("AddColumn(%q, %q): got nil error, want error", test.table, test.columnDef)
+		}
+	}
+	if len(srv.updates) != 1 {
+		t.Errorf("got %d updates, want 1", len(srv.updates))
+	}
+}
+
+func TestSchemaDriftReport(t *testing.T) {
+	srv := &ddlServer{statements: singerStatements[:3]}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	expected := []string{
+		"CREATE TABLE Singers (SingerId INT64 NOT NULL, FirstName STRING(1024)) PRIMARY KEY(SingerId);",
+		"CREATE INDEX SingerByName ON Singers (FirstName)",
+		"CREATE INDEX SingerByName ON Singers (FirstName)",
+		"CREATE TABLE `Order` (OrderId INT64 NOT NULL) PRIMARY KEY(OrderId)",
+	}
+	added, missing, err := c.SchemaDriftReport(context.Background(), "db", expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := singerStatements[2:3]; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %q, want %q", added, want)
+	}
+	if want := expected[2:]; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %q, want %q", missing, want)
+	}
+
+	added, missing, err = c.SchemaDriftReport(context.Background(), "db", singerStatements[:3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || len(missing) != 0 {
+		t.Errorf("identical schema: added = %q, missing = %q, want none", added, missing)
+	}
+
+	// Statements that differ only in order and layout are equivalent and
+	// show no drift.
+	reordered := []string{
+		"CREATE TABLE `Order` (OrderId INT64 NOT NULL, SingerId INT64, UpdatedAt TIMESTAMP OPTIONS (allow_commit_timestamp=true), CONSTRAINT FK_Singer FOREIGN KEY (SingerId) REFERENCES Singers (SingerId)) PRIMARY KEY(OrderId)",
+		"CREATE INDEX `SingerByName` ON `Singers` (FirstName);",
+		"CREATE TABLE Singers (\n\tSingerId INT64 NOT NULL,\n\tFirstName STRING(1024)\n) PRIMARY KEY (SingerId)",
+	}
+	if !DDLEquivalent(singerStatements[:3], reordered) {
+		t.Error("DDLEquivalent = false for reordered statements, want true")
+	}
+	added, missing, err = c.SchemaDriftReport(context.Background(), "db", reordered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || len(missing) != 0 {
+		t.Errorf("reordered schema: added = %q, missing = %q, want none", added, missing)
+	}
+}
+
+func TestDropObject(t *testing.T) {
+	srv := &ddlServer{statements: singerStatements}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	for _, test := range []struct {
+		object string
+		want   []string
+	}{
+		{"singerbyname", []string{"DROP INDEX `SingerByName`"}},
+		{"Albums", []string{
+			"ALTER TABLE `Singers` DROP CONSTRAINT `FK_Album`",
+			"DROP INDEX `AlbumsByAlbumId`",
+			"DROP TABLE `Albums`",
+		}},
+		{"Singers", []string{
+			"ALTER TABLE `Singers` DROP CONSTRAINT `FK_Album`",
+			"DROP INDEX `SingerByName`",
+			"DROP TABLE `Singers`",
+		}},
+		{"Order", []string{"DROP TABLE `Order`"}},
+	} {
+		srv.updates = nil
+		if err := c.DropObject(context.Background(), "db", test.object); err != nil {
+			t.Errorf("DropObject(%q): %v", test.object, err)
+			continue
+		}
+		if want := [][]string{test.want}; !reflect.DeepEqual(srv.updates, want) {
+			t.Errorf("DropObject(%q): got updates %q, want %q", test.object, srv.updates, want)
+		}
+	}
+
+	srv.updates = nil
+	for _, object := range []string{"Nothing", "FK_Album"} {
+		if err := c.DropObject(context.Background(), "db", object); err == nil {
+			t.Errorf("DropObject(%q): got nil error, want error", object)
+		}
+	}
+	if len(srv.updates) != 0 {
+		t.Errorf("got updates %q, want none", srv.updates)
+	}
+}
+
+// describeServer serves a ready database with the singer schema.
+type describeServer struct {
+	ddlServer
+}
+
+func (s *describeServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	return &databasepb.Database{Name: req.Name, State: databasepb.Database_READY}, nil
+}
+
+func TestDescribeDatabase(t *testing.T) {
+	srv := &describeServer{ddlServer{statements: singerStatements}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	got, err := c.DescribeDatabase(context.Background(), "db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DatabaseDescription{
+		Name:           "db",
+		State:          databasepb.Database_READY,
+		StatementCount: 6,
+		Tables:         []string{"Singers", "Order", "Albums"},
+		Indexes:        []string{"SingerByName", "AlbumsByAlbumId"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestReconcileIndexes(t *testing.T) {
+	srv := &ddlServer{statements: singerStatements}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	desired := []IndexSpec{
+		{Name: "singerbyname", Table: "Singers", Columns: []KeyPart{{Column: "LastName"}}},
+		{Name: "OrderByUpdate", Table: "Order", Columns: []KeyPart{{Column: "UpdatedAt", Desc: true}, {Column: "OrderId"}}, Storing: []string{"SingerId"}, Unique: true},
+		{Name: "AlbumsBySinger", Table: "Albums", Columns: []KeyPart{{Column: "SingerId"}}, NullFiltered: true, InterleaveIn: "Singers"},
+	}
+	if err := c.ReconcileIndexes(context.Background(), "db", desired); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{
+		"CREATE UNIQUE INDEX `OrderByUpdate` ON `Order` (`UpdatedAt` DESC, `OrderId`) STORING (`SingerId`)",
+		"CREATE NULL_FILTERED INDEX `AlbumsBySinger` ON `Albums` (`SingerId`), INTERLEAVE IN `Singers`",
+	}}
+	if !reflect.DeepEqual(srv.updates, want) {
+		t.Errorf("got updates\n%q\nwant\n%q", srv.updates, want)
+	}
+
+	srv.updates = nil
+	if err := c.ReconcileIndexes(context.Background(), "db", desired[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(srv.updates) != 0 {
+		t.Errorf("got updates %q when every index exists, want none", srv.updates)
+	}
+
+	bad := []IndexSpec{{Name: "Bad Name", Table: "Singers", Columns: []KeyPart{{Column: "FirstName"}}}}
+	if err := c.ReconcileIndexes(context.Background(), "db", bad); err == nil {
+		t.Error("got nil error for an invalid index name")
+	}
+	if len(srv.updates) != 0 {
+		t.Errorf("got updates %q for an invalid index, want none", srv.updates)
+	}
+}
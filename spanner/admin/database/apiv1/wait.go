@@ -0,0 +1,272 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/internal/trace"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	gax "github.com/googleapis/gax-go/v2"
+	octrace "go.opencensus.io/trace"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	instancepb "google.golang.org/genproto/googleapis/spanner/admin/instance/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pollBackoff is the backoff between attempts of the polling helpers in this
+// package. Unless jitter is disabled with WithPollJitter, each pause is chosen
+// at random between zero and the current interval, so that concurrent waits
+// do not poll in step.
+var pollBackoff = gax.Backoff{
+	Initial:    1000 * time.Millisecond,
+	Max:        32000 * time.Millisecond,
+	Multiplier: 1.3,
+}
+
+// poll calls f until it reports done or returns an error, pausing between
+// calls according to pollBackoff and the jitter setting in ctx. Errors for
+// which the server suggested a retry delay are not returned; instead f is
+// called again after that delay. If ctx is done first, poll returns
+// ctx.Err().
+func poll(ctx context.Context, f func() (done bool, err error)) error {
+	pause := pollPauser(ctx)
+	for {
+		done, err := f()
+		if err == nil && done {
+			return nil
+		}
+		delay := pause()
+		if err != nil {
+			serverDelay, ok := RetryDelayFromError(err)
+			if !ok {
+				return err
+			}
+			delay = serverDelay
+		}
+		if err := gax.Sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// pollPauser returns a function that returns the successive pauses of a
+// poll: random pauses from pollBackoff, or, if jitter is disabled in ctx, the
+// full current interval of pollBackoff each time.
+func pollPauser(ctx context.Context) func() time.Duration {
+	bo := pollBackoff
+	if on, ok := ctx.Value(pollJitterKey{}).(bool); !ok || on {
+		return bo.Pause
+	}
+	cur := bo.Initial
+	return func() time.Duration {
+		d := cur
+		cur = time.Duration(float64(cur) * bo.Multiplier)
+		if cur > bo.Max {
+			cur = bo.Max
+		}
+		return d
+	}
+}
+
+type pollJitterKey struct{}
+
+// WithPollJitter returns a copy of ctx that sets whether the polling helpers
+// in this package, such as AwaitDatabaseState and WaitForSchemaObject,
+// randomize the pauses between their calls. Jitter is enabled by default:
+// each pause is chosen at random between zero and the current backoff
+// interval, so that many concurrent waits do not poll the service in step.
+// With enabled false, each pause is the full interval, which makes the
+// timing of a wait predictable.
+//
+// The setting does not apply to waiting for a long-running operation, as
+// with CreateDatabaseOperation.Wait; such waits use the backoff of the
+// longrunning package.
+func WithPollJitter(ctx context.Context, enabled bool) context.Context {
+	return context.WithValue(ctx, pollJitterKey{}, enabled)
+}
+
+type operationLabelKey struct{}
+
+// WithOperationLabel returns a copy of ctx carrying label, to tell apart
+// concurrent waits in traces. The helpers in this package that wait for an
+// operation to finish or for a resource to reach some state create a trace
+// span for the wait; when called with a context from WithOperationLabel, they
+// give the span a "label" attribute with the value label.
+func WithOperationLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, operationLabelKey{}, label)
+}
+
+type spanAttributesKey struct{}
+
+// WithSpanAttributes returns a copy of ctx carrying attrs, for example to
+// attribute waits to a tenant or cost center. The wait spans that the helpers
+// in this package create when called with such a context get a string
+// attribute for each entry of attrs, in addition to those of any earlier
+// WithSpanAttributes call on ctx. A label from WithOperationLabel takes
+// precedence over a "label" entry.
+func WithSpanAttributes(ctx context.Context, attrs map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range spanAttributes(ctx) {
+		merged[k] = v
+	}
+	for k, v := range attrs {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, spanAttributesKey{}, merged)
+}
+
+func spanAttributes(ctx context.Context) map[string]string {
+	attrs, _ := ctx.Value(spanAttributesKey{}).(map[string]string)
+	return attrs
+}
+
+// startWaitSpan starts the trace span for a wait by the helper name, with
+// the attributes and operation label in ctx, if any. The caller must end the
+// span with trace.EndSpan.
+func startWaitSpan(ctx context.Context, name string) context.Context {
+	ctx = trace.StartSpan(ctx, "cloud.google.com/go/spanner/admin/database/apiv1."+name)
+	if attrs := spanAttributes(ctx); len(attrs) > 0 {
+		var as []octrace.Attribute
+		for k, v := range attrs {
+			as = append(as, octrace.StringAttribute(k, v))
+		}
+		octrace.FromContext(ctx).AddAttributes(as...)
+	}
+	if label, ok := ctx.Value(operationLabelKey{}).(string); ok {
+		octrace.FromContext(ctx).AddAttributes(octrace.StringAttribute("label", label))
+	}
+	return ctx
+}
+
+// ctxErrCode returns the gRPC code corresponding to a done context.
+func ctxErrCode(ctx context.Context) codes.Code {
+	if ctx.Err() == context.Canceled {
+		return codes.Canceled
+	}
+	return codes.DeadlineExceeded
+}
+
+// AwaitDatabaseState polls the database until it reaches the target state and
+// returns it. If timeout is positive, AwaitDatabaseState gives up after
+// timeout has passed; it also gives up when ctx is done. In both cases the
+// returned error reports the state the database was last observed in.
+func (c *DatabaseAdminClient) AwaitDatabaseState(ctx context.Context, databaseName string, target databasepb.Database_State, timeout time.Duration, opts ...gax.CallOption) (*databasepb.Database, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var last *databasepb.Database
+	ctx = startWaitSpan(ctx, "AwaitDatabaseState")
+	err := poll(ctx, func() (bool, error) {
+		db, err := c.GetDatabase(ctx, &databasepb.GetDatabaseRequest{Name: databaseName}, opts...)
+		if err != nil {
+			return false, err
+		}
+		last = db
+		return db.State == target, nil
+	})
+	trace.EndSpan(ctx, err)
+	if err != nil && ctx.Err() != nil {
+		state := "unknown"
+		if last != nil {
+			state = last.State.String()
+		}
+		return nil, status.Errorf(ctxErrCode(ctx), "database: %s did not reach state %v: %v; last observed state %s", databaseName, target, ctx.Err(), state)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return last, nil
+}
+
+// CreateDatabaseAndWaitWithOp creates a database as CreateDatabase does and
+// waits for it to be created. It returns the database and the name of the
+// operation that created it. If the operation was started but failed, the
+// operation name is returned along with the error.
+func (c *DatabaseAdminClient) CreateDatabaseAndWaitWithOp(ctx context.Context, req *databasepb.CreateDatabaseRequest, opts ...gax.CallOption) (db *databasepb.Database, opName string, err error) {
+	op, err := c.CreateDatabase(ctx, req, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	ctx = startWaitSpan(ctx, "CreateDatabaseAndWaitWithOp")
+	db, err = op.Wait(ctx, opts...)
+	trace.EndSpan(ctx, err)
+	if err != nil {
+		return nil, op.Name(), err
+	}
+	return db, op.Name(), nil
+}
+
+// WaitForSchemaObject polls the schema of the database databaseName until it
+// contains a statement creating the table or index objectName, then returns
+// nil. kind is "TABLE" or "INDEX", in any case. Names are compared ignoring
+// case, as Cloud Spanner does. If ctx is done first, WaitForSchemaObject
+// returns an error with the corresponding code.
+//
+// WaitForSchemaObject is meant for coordinating with a schema change made
+// by another process; when the change is made by the caller, waiting for its
+// operation is enough.
+func (c *DatabaseAdminClient) WaitForSchemaObject(ctx context.Context, databaseName, objectName, kind string, opts ...gax.CallOption) error {
+	kind = strings.ToUpper(kind)
+	if kind != "TABLE" && kind != "INDEX" {
+		return fmt.Errorf("database: unsupported schema object kind %q, want TABLE or INDEX", kind)
+	}
+	ctx = startWaitSpan(ctx, "WaitForSchemaObject")
+	err := poll(ctx, func() (bool, error) {
+		resp, err := c.GetDatabaseDdl(ctx, &databasepb.GetDatabaseDdlRequest{Database: databaseName}, opts...)
+		if err != nil {
+			return false, err
+		}
+		for _, stmt := range resp.Statements {
+			if o, ok := createdObject(stmt); ok && o.kind == kind && strings.EqualFold(o.name, objectName) {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	trace.EndSpan(ctx, err)
+	if err != nil && ctx.Err() != nil {
+		return status.Errorf(ctxErrCode(ctx), "database: %s %s did not appear in %s: %v", strings.ToLower(kind), objectName, databaseName, ctx.Err())
+	}
+	return err
+}
+
+// WaitForInstanceReady polls the instance instancePath with instAdmin until
+// it is READY, so that databases can be created in an instance that was just
+// created. If ctx is done first, WaitForInstanceReady returns an error with
+// the corresponding code.
+func WaitForInstanceReady(ctx context.Context, instAdmin *instance.InstanceAdminClient, instancePath string, opts ...gax.CallOption) error {
+	last := instancepb.Instance_STATE_UNSPECIFIED
+	ctx = startWaitSpan(ctx, "WaitForInstanceReady")
+	err := poll(ctx, func() (bool, error) {
+		inst, err := instAdmin.GetInstance(ctx, &instancepb.GetInstanceRequest{Name: instancePath}, opts...)
+		if err != nil {
+			return false, err
+		}
+		last = inst.State
+		return inst.State == instancepb.Instance_READY, nil
+	})
+	trace.EndSpan(ctx, err)
+	if err != nil && ctx.Err() != nil {
+		return status.Errorf(ctxErrCode(ctx), "database: instance %s did not become ready: %v; last observed state %v", instancePath, ctx.Err(), last)
+	}
+	return err
+}
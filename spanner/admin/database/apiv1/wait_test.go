@@ -0,0 +1,341 @@
+// Copyright 2019 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	"github.com/golang/protobuf/proto"
+	gax "github.com/googleapis/gax-go/v2"
+	octrace "go.opencensus.io/trace"
+	"google.golang.org/api/option"
+	databasepb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	instancepb "google.golang.org/genproto/googleapis/spanner/admin/instance/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statesServer serves GetDatabase with the given states in turn, repeating the
+// last one forever.
+type statesServer struct {
+	mockDatabaseAdminServer
+
+	mu     sync.Mutex
+	states []databasepb.Database_State
+	calls  int
+}
+
+func (s *statesServer) GetDatabase(ctx context.Context, req *databasepb.GetDatabaseRequest) (*databasepb.Database, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.calls
+	if i >= len(s.states) {
+		i = len(s.states) - 1
+	}
+	s.calls++
+	return &databasepb.Database{Name: req.Name, State: s.states[i]}, nil
+}
+
+// fastPoll makes the polling helpers poll quickly for the duration of a test.
+func fastPoll() func() {
+	old := pollBackoff
+	pollBackoff = gax.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}
+	return func() { pollBackoff = old }
+}
+
+func TestAwaitDatabaseState(t *testing.T) {
+	defer fastPoll()()
+	srv := &statesServer{states: []databasepb.Database_State{databasepb.Database_CREATING, databasepb.Database_CREATING, databasepb.Database_READY}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	db, err := c.AwaitDatabaseState(context.Background(), "db", databasepb.Database_READY, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.State != databasepb.Database_READY {
+		t.Errorf("state = %v, want READY", db.State)
+	}
+	if srv.calls != 3 {
+		t.Errorf("got %d GetDatabase calls, want 3", srv.calls)
+	}
+}
+
+func TestAwaitDatabaseStateTimeout(t *testing.T) {
+	defer fastPoll()()
+	srv := &statesServer{states: []databasepb.Database_State{databasepb.Database_CREATING}}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	_, err := c.AwaitDatabaseState(context.Background(), "db", databasepb.Database_READY, 50*time.Millisecond)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("got %v, want DeadlineExceeded", err)
+	}
+	if !strings.Contains(err.Error(), "last observed state CREATING") {
+		t.Errorf("error %q does not report the last observed state", err)
+	}
+}
+
+func TestCreateDatabaseAndWaitWithOp(t *testing.T) {
+	expectedResponse := &databasepb.Database{Name: "projects/p/instances/i/databases/d"}
+	mockDatabaseAdmin.err = nil
+	mockDatabaseAdmin.reqs = nil
+	mockDatabaseAdmin.resps = append(mockDatabaseAdmin.resps[:0], doneOp(t, expectedResponse))
+
+	c, err := NewDatabaseAdminClient(context.Background(), clientOpt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &databasepb.CreateDatabaseRequest{Parent: "projects/p/instances/i", CreateStatement: "CREATE DATABASE d"}
+	db, opName, err := c.CreateDatabaseAndWaitWithOp(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(db, expectedResponse) {
+		t.Errorf("wrong response %q, want %q", db, expectedResponse)
+	}
+	if got, want := opName, "longrunning-test"; got != want {
+		t.Errorf("operation name %q, want %q", got, want)
+	}
+
+	mockDatabaseAdmin.err = status.Error(codes.AlreadyExists, "exists")
+	if _, opName, err := c.CreateDatabaseAndWaitWithOp(context.Background(), req); status.Code(err) != codes.AlreadyExists || opName != "" {
+		t.Errorf("got (%q, %v), want no operation name and AlreadyExists", opName, err)
+	}
+	mockDatabaseAdmin.err = nil
+}
+
+// revealingDDLServer serves one more of its statements from each call of
+// GetDatabaseDdl.
+type revealingDDLServer struct {
+	mockDatabaseAdminServer
+
+	mu         sync.Mutex
+	statements []string
+	calls      int
+}
+
+func (s *revealingDDLServer) GetDatabaseDdl(ctx context.Context, req *databasepb.GetDatabaseDdlRequest) (*databasepb.GetDatabaseDdlResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls < len(s.statements) {
+		s.calls++
+	}
+	return &databasepb.GetDatabaseDdlResponse{Statements: s.statements[:s.calls]}, nil
+}
+
+func TestWaitForSchemaObject(t *testing.T) {
+	defer fastPoll()()
+	srv := &revealingDDLServer{statements: singerStatements}
+	c, stop := newServerClient(t, srv)
+	defer stop()
+	defer c.Close()
+
+	if err := c.WaitForSchemaObject(context.Background(), "db", "albums", "table"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.calls != 4 {
+		t.Errorf("got %d GetDatabaseDdl calls, want 4", srv.calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// Albums is a table, not an index.
+	if err := c.WaitForSchemaObject(ctx, "db", "Albums", "INDEX"); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("got %v, want DeadlineExceeded", err)
+	}
+	if err := c.WaitForSchemaObject(context.Background(), "db", "FK_Album", "CONSTRAINT"); err == nil {
+		t.Error("kind CONSTRAINT: got nil error, want error")
+	}
+}
+
+// spanRecorder is a trace exporter that keeps the spans it is given.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*octrace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *octrace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+// recordSpans samples and records every span until the returned function is
+// called.
+func recordSpans() (*spanRecorder, func()) {
+	r := &spanRecorder{}
+	octrace.RegisterExporter(r)
+	octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.AlwaysSample()})
+	return r, func() {
+		octrace.UnregisterExporter(r)
+		octrace.ApplyConfig(octrace.Config{DefaultSampler: octrace.ProbabilitySampler(1e-4)})
+	}
+}
+
+func TestWithOperationLabel(t *testing.T) {
+	defer fastPoll()()
+	rec, stop := recordSpans()
+	defer stop()
+	srv := &statesServer{states: []databasepb.Database_State{databasepb.Database_CREATING, databasepb.Database_READY}}
+	c, stopServer := newServerClient(t, srv)
+	defer stopServer()
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	for _, label := range []string{"db-a", "db-b"} {
+		wg.Add(1)
+		go func(label string) {
+			defer wg.Done()
+			ctx := WithOperationLabel(context.Background(), label)
+			if _, err := c.AwaitDatabaseState(ctx, label, databasepb.Database_READY, time.Minute); err != nil {
+				t.Error(err)
+			}
+		}(label)
+	}
+	wg.Wait()
+
+	labels := map[string]bool{}
+	for _, s := range rec.spans {
+		if s.Name == "cloud.google.com/go/spanner/admin/database/apiv1.AwaitDatabaseState" {
+			if l, ok := s.Attributes["label"].(string); ok {
+				labels[l] = true
+			}
+		}
+	}
+	if !labels["db-a"] || !labels["db-b"] || len(labels) != 2 {
+		t.Errorf("got labelled wait spans %v, want db-a and db-b", labels)
+	}
+}
+
+func TestWithSpanAttributes(t *testing.T) {
+	defer fastPoll()()
+	rec, stop := recordSpans()
+	defer stop()
+	srv := &statesServer{states: []databasepb.Database_State{databasepb.Database_READY}}
+	c, stopServer := newServerClient(t, srv)
+	defer stopServer()
+	defer c.Close()
+
+	attrs := map[string]string{"tenant": "a", "cost_center": "1"}
+	ctx := WithSpanAttributes(context.Background(), attrs)
+	ctx = WithSpanAttributes(ctx, map[string]string{"cost_center": "2", "label": "ignored"})
+	ctx = WithOperationLabel(ctx, "db")
+	attrs["tenant"] = "changed"
+	if _, err := c.AwaitDatabaseState(ctx, "db", databasepb.Database_READY, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	for _, s := range rec.spans {
+		if s.Name == "cloud.google.com/go/spanner/admin/database/apiv1.AwaitDatabaseState" {
+			got = s.Attributes
+		}
+	}
+	want := map[string]interface{}{"tenant": "a", "cost_center": "2", "label": "db"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got span attributes %v, want %v", got, want)
+	}
+}
+
+func TestWithPollJitter(t *testing.T) {
+	defer fastPoll()()
+
+	pause := pollPauser(WithPollJitter(context.Background(), false))
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, pause())
+	}
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond, 5 * time.Millisecond, 5 * time.Millisecond}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("without jitter: got pauses %v, want %v", got, want)
+	}
+
+	for _, ctx := range []context.Context{context.Background(), WithPollJitter(context.Background(), true)} {
+		pause := pollPauser(ctx)
+		for i, max := range want {
+			if d := pause(); d <= 0 || d > max {
+				t.Errorf("with jitter: pause %d is %v, want in (0, %v]", i, d, max)
+			}
+		}
+	}
+}
+
+// instanceStatesServer serves GetInstance with the given states in turn,
+// repeating the last one forever. Its other methods are not implemented.
+type instanceStatesServer struct {
+	instancepb.InstanceAdminServer
+
+	mu     sync.Mutex
+	states []instancepb.Instance_State
+	calls  int
+}
+
+func (s *instanceStatesServer) GetInstance(ctx context.Context, req *instancepb.GetInstanceRequest) (*instancepb.Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.states[len(s.states)-1]
+	if s.calls < len(s.states) {
+		st = s.states[s.calls]
+	}
+	s.calls++
+	return &instancepb.Instance{Name: req.Name, State: st}, nil
+}
+
+func TestWaitForInstanceReady(t *testing.T) {
+	defer fastPoll()()
+	srv := &instanceStatesServer{states: []instancepb.Instance_State{instancepb.Instance_CREATING, instancepb.Instance_READY}}
+	serv := grpc.NewServer()
+	instancepb.RegisterInstanceAdminServer(serv, srv)
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go serv.Serve(lis)
+	defer serv.Stop()
+	ic, err := instance.NewInstanceAdminClient(context.Background(),
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithInsecure()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ic.Close()
+
+	if err := WaitForInstanceReady(context.Background(), ic, "projects/p/instances/i"); err != nil {
+		t.Fatal(err)
+	}
+	if srv.calls != 2 {
+		t.Errorf("got %d GetInstance calls, want 2", srv.calls)
+	}
+
+	srv.states, srv.calls = []instancepb.Instance_State{instancepb.Instance_CREATING}, 0
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = WaitForInstanceReady(ctx, ic, "projects/p/instances/i")
+	if status.Code(err) != codes.DeadlineExceeded || !strings.Contains(err.Error(), "last observed state CREATING") {
+		t.Errorf("got %v, want DeadlineExceeded reporting state CREATING", err)
+	}
+}